@@ -5,18 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/kon-rad/openclaw-trace/internal/config"
 	"github.com/kon-rad/openclaw-trace/internal/db"
 	"github.com/kon-rad/openclaw-trace/internal/ingest"
 	"github.com/kon-rad/openclaw-trace/internal/logparse"
 	"github.com/kon-rad/openclaw-trace/internal/metrics"
+	"github.com/kon-rad/openclaw-trace/internal/proxy"
 	"github.com/kon-rad/openclaw-trace/internal/push"
+	"github.com/kon-rad/openclaw-trace/internal/redact"
 	"github.com/kon-rad/openclaw-trace/internal/server"
+	"github.com/kon-rad/openclaw-trace/internal/stream"
 )
 
 type Runtime struct {
@@ -26,35 +34,90 @@ type Runtime struct {
 	startedAt  time.Time
 	dbm        *db.Manager
 	httpServer *http.Server
+	// ingestMu guards ingestCh, which shutdown closes and sets to nil while
+	// proxied streams may still be finishing.
+	ingestMu   sync.RWMutex
 	ingestCh   chan ingest.Event
+	worker     *ingest.Worker
 	workerDone chan error
 	bgCancel   context.CancelFunc
+	// workerStop tells the supervised worker to stop retrying at shutdown.
+	workerStop context.CancelFunc
 	bgWG       sync.WaitGroup
 	pusher     *push.Pusher
+	spill      *ingest.Spill
+	streams    *stream.Tracker
+	udp        *server.UDPReceiver
+	udpConn    net.PacketConn
+	redactor   *redact.Redactor
+	sampler    *ingest.Sampler
+	processors ingest.Chain
 
+	backpressure   *ingest.Backpressure
 	eventsReceived atomic.Int64
 	eventsDropped  atomic.Int64
+	eventsFiltered atomic.Int64
+	securityLeaks  atomic.Int64
+	droppedMu      sync.Mutex
+	droppedByKind  map[ingest.EventKind]int64
 	lastPushTime   atomic.Int64
 	lastPushStatus atomic.Value
 }
 
 func New(cfg *config.Config, logger *slog.Logger, version string) *Runtime {
 	r := &Runtime{
-		cfg:       cfg,
-		logger:    logger,
-		version:   version,
-		startedAt: time.Now(),
+		cfg:           cfg,
+		logger:        logger,
+		version:       version,
+		startedAt:     time.Now(),
+		droppedByKind: map[ingest.EventKind]int64{},
 	}
 	r.lastPushStatus.Store("disabled")
 	return r
 }
 
 func (r *Runtime) Run(ctx context.Context) error {
+	policy, err := ingest.ParseQueueFullPolicy(r.cfg.QueueFullPolicy)
+	if err != nil {
+		return fmt.Errorf("invalid OCT_QUEUE_FULL_POLICY: %w", err)
+	}
+	r.backpressure = ingest.NewBackpressure(policy, r.cfg.QueueBlockTimeout)
+	truncateMode, err := ingest.ParseTruncateMode(r.cfg.TruncateMode)
+	if err != nil {
+		return fmt.Errorf("invalid OCT_TRUNCATE_MODE: %w", err)
+	}
+	promptStore, err := db.ParsePromptStoreMode(r.cfg.PromptStore)
+	if err != nil {
+		return fmt.Errorf("invalid OCT_PROMPT_STORE: %w", err)
+	}
+	if !r.cfg.TCPEnabled && r.cfg.UnixSocketPath == "" {
+		return errors.New("no listener enabled: set OCT_TCP_ENABLED=true or OCT_UNIX_SOCKET_PATH")
+	}
+	socketMode, err := strconv.ParseUint(r.cfg.UnixSocketMode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid OCT_UNIX_SOCKET_MODE: %w", err)
+	}
+	access, err := r.accessControl()
+	if err != nil {
+		return err
+	}
+	if r.redactor, err = r.newRedactor(); err != nil {
+		return err
+	}
+	if r.sampler, err = r.newSampler(); err != nil {
+		return err
+	}
+	if r.processors, err = r.newProcessors(); err != nil {
+		return err
+	}
+
 	dbm, err := db.Open(r.cfg.DBPath)
 	if err != nil {
 		return fmt.Errorf("open database: %w", err)
 	}
 	r.dbm = dbm
+	r.dbm.SetPromptStore(promptStore, r.cfg.PromptStoreMinBytes)
+	r.dbm.SetCompression(r.cfg.CompressMinBytes)
 
 	journalMode, busyTimeout, autoVacuum, err := r.dbm.Pragmas(ctx)
 	if err != nil {
@@ -65,16 +128,33 @@ func (r *Runtime) Run(ctx context.Context) error {
 		"journal_mode", journalMode,
 		"busy_timeout", busyTimeout,
 		"auto_vacuum", autoVacuum,
-		"tables", 4,
+		"tables", 9,
 	)
 
+	if r.cfg.SpillMaxBytes > 0 {
+		spill, err := ingest.OpenSpill(r.cfg.DBPath+".spill", r.cfg.SpillMaxBytes)
+		if err != nil {
+			return fmt.Errorf("open spill: %w", err)
+		}
+		r.spill = spill
+		r.backpressure.SetSpill(spill)
+		if pending := spill.Pending(); pending > 0 {
+			r.logger.Info("Replaying spilled events", "pending", pending)
+		}
+	}
+
 	healthHandler := server.NewHealthHandler(r.dbm, r.startedAt, r.version, r, r.cfg.PushEndpoint == "")
-	r.ingestCh = make(chan ingest.Event, ingest.QueueCapacity)
+	ingestCh := make(chan ingest.Event, ingest.QueueCapacity)
+	r.ingestCh = ingestCh
 	r.workerDone = make(chan error, 1)
 
-	worker := ingest.NewWorker(r.logger, r.dbm, r.cfg.MaxTextBytes)
+	r.worker = ingest.NewWorker(r.logger, r.dbm, r.cfg.MaxTextBytes)
+	r.worker.SetSpill(r.spill)
+	r.worker.SetTruncateMode(truncateMode)
+	workerCtx, workerStop := context.WithCancel(context.Background())
+	r.workerStop = workerStop
 	go func() {
-		r.workerDone <- worker.Run(r.ingestCh)
+		r.workerDone <- r.worker.Supervise(workerCtx, ingestCh)
 	}()
 
 	if r.cfg.PushEndpoint != "" {
@@ -82,21 +162,59 @@ func (r *Runtime) Run(ctx context.Context) error {
 		r.lastPushStatus.Store("ready")
 	}
 
+	r.streams = stream.NewTracker(r, r.cfg.StreamTimeout, r.cfg.MaxTextBytes)
+	if r.redactor != nil {
+		r.streams.SetRedact(r.redactor.Text)
+	}
+	r.streams.SetTruncateMode(truncateMode)
+
 	bgCtx, bgCancel := context.WithCancel(context.Background())
 	r.bgCancel = bgCancel
-	r.startBackgroundLoops(bgCtx)
 	ingestHandlers := server.NewIngestHandlers(r)
-	r.httpServer = server.New(":"+r.cfg.Port, healthHandler.ServeHTTP, ingestHandlers)
-
-	serverErr := make(chan error, 1)
-	go func() {
-		r.logger.Info("Listening", "addr", ":"+r.cfg.Port)
-		if err := r.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			serverErr <- err
-			return
+	ingestHandlers.SetTimeBounds(r.cfg.MaxClockSkew, r.cfg.MaxEventAge)
+	ingestHandlers.SetRejectWhenFull(policy == ingest.PolicyReject)
+	ingestHandlers.SetStreamTracker(r.streams)
+	ingestHandlers.SetDeadLetterStore(r.dbm)
+	if r.cfg.ProxyEnabled {
+		llmProxy, err := proxy.New(r, map[string]string{
+			"openai":    r.cfg.ProxyOpenAIURL,
+			"anthropic": r.cfg.ProxyAnthropicURL,
+			"gemini":    r.cfg.ProxyGeminiURL,
+		})
+		if err != nil {
+			return err
 		}
-		serverErr <- nil
-	}()
+		ingestHandlers.SetProxy(llmProxy)
+		r.logger.Info("LLM proxy enabled", "path", proxy.PathPrefix)
+	}
+	if r.cfg.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", r.cfg.UDPAddr)
+		if err != nil {
+			return fmt.Errorf("listen udp: %w", err)
+		}
+		r.udpConn = conn
+		r.udp = server.NewUDPReceiver(ingestHandlers, r.cfg.UDPMaxDatagramBytes)
+		r.udp.SetAccessControl(access)
+		r.logger.Info("Listening", "network", "udp", "addr", conn.LocalAddr().String())
+	}
+	r.startBackgroundLoops(bgCtx)
+	r.httpServer = server.New(r.tcpAddr(), healthHandler.ServeHTTP, ingestHandlers, access)
+
+	listeners, err := r.listen(os.FileMode(socketMode))
+	if err != nil {
+		return err
+	}
+	serverErr := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func() {
+			r.logger.Info("Listening", "network", ln.Addr().Network(), "addr", ln.Addr().String())
+			if err := r.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+				return
+			}
+			serverErr <- nil
+		}()
+	}
 
 	select {
 	case err := <-serverErr:
@@ -110,6 +228,160 @@ func (r *Runtime) Run(ctx context.Context) error {
 	}
 }
 
+func (r *Runtime) tcpAddr() string {
+	return net.JoinHostPort(r.cfg.BindAddr, r.cfg.Port)
+}
+
+// accessControl builds the allowlist and token check, or returns nil when
+// neither is configured.
+func (r *Runtime) accessControl() (*server.AccessControl, error) {
+	tokens, err := server.ParseTokens(r.cfg.AuthTokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCT_AUTH_TOKENS: %w", err)
+	}
+	allowed, err := server.ParseCIDRs(r.cfg.AllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCT_ALLOWED_CIDRS: %w", err)
+	}
+	if len(tokens) == 0 && len(allowed) == 0 {
+		return nil, nil
+	}
+	access := server.NewAccessControl(tokens, allowed)
+	access.SetProtectHealth(r.cfg.HealthAuth)
+	r.logger.Info("Ingest access control enabled", "token_sources", len(tokens), "allowed_cidrs", len(allowed))
+	return access, nil
+}
+
+// newProcessors builds the chain run on every event: the processors named in
+// OCT_PROCESSORS in order, then redaction and sampling, which must see the
+// event as it will be stored. Redaction comes first so the sizes and hashes
+// the sampler keeps describe redacted text.
+func (r *Runtime) newProcessors() (ingest.Chain, error) {
+	var chain ingest.Chain
+	var names []string
+	for _, name := range strings.Split(r.cfg.Processors, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "host_labels":
+			labels, err := ingest.ParseLabels(r.cfg.HostLabels)
+			if err != nil {
+				return nil, fmt.Errorf("invalid OCT_HOST_LABELS: %w", err)
+			}
+			if _, ok := labels["host"]; !ok {
+				if host, err := os.Hostname(); err == nil {
+					labels["host"] = host
+				}
+			}
+			chain = append(chain, ingest.HostLabels(labels))
+		case "defaults":
+			defaults, err := ingest.ParseLabels(r.cfg.FieldDefaults)
+			if err != nil {
+				return nil, fmt.Errorf("invalid OCT_FIELD_DEFAULTS: %w", err)
+			}
+			p, err := ingest.FieldDefaults(defaults)
+			if err != nil {
+				return nil, fmt.Errorf("invalid OCT_FIELD_DEFAULTS: %w", err)
+			}
+			chain = append(chain, p)
+		case "normalize":
+			chain = append(chain, ingest.Normalize())
+		default:
+			return nil, fmt.Errorf("invalid OCT_PROCESSORS: unknown processor %q", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) > 0 {
+		r.logger.Info("Event processors enabled", "processors", names)
+	}
+	if r.redactor != nil {
+		chain = append(chain, r.redactor)
+	}
+	if r.sampler != nil {
+		chain = append(chain, r.sampler)
+	}
+	return chain, nil
+}
+
+// newSampler returns nil when every trace keeps its full text.
+func (r *Runtime) newSampler() (*ingest.Sampler, error) {
+	rules, err := ingest.ParseSampleRules(r.cfg.SampleRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCT_SAMPLE_RULES: %w", err)
+	}
+	if r.cfg.SampleRate >= 1 && len(rules) == 0 {
+		return nil, nil
+	}
+	tier, err := ingest.ParseSampleTier(r.cfg.SampleTier)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCT_SAMPLE_TIER: %w", err)
+	}
+	sampler, err := ingest.NewSampler(rules, r.cfg.SampleRate, tier, r.cfg.SampleKeepSlowestPct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sampling config: %w", err)
+	}
+	r.logger.Info("Trace sampling enabled", "rate", r.cfg.SampleRate, "rules", len(rules), "tier", string(tier), "keep_slowest_pct", r.cfg.SampleKeepSlowestPct)
+	return sampler, nil
+}
+
+// newRedactor returns nil when no redaction rules are configured.
+func (r *Runtime) newRedactor() (*redact.Redactor, error) {
+	mode, err := redact.ParseMode(r.cfg.RedactMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCT_REDACT_MODE: %w", err)
+	}
+	custom, err := redact.ParseCustomRules(r.cfg.RedactRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCT_REDACT_RULES: %w", err)
+	}
+	var builtins []string
+	for _, name := range strings.Split(r.cfg.Redact, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			builtins = append(builtins, name)
+		}
+	}
+	if len(builtins) == 1 && builtins[0] == "all" {
+		builtins = redact.Builtins
+	}
+	if len(builtins) == 0 && len(custom) == 0 {
+		return nil, nil
+	}
+	redactor, err := redact.New(builtins, custom, mode, r.cfg.RedactHashKey)
+	if errors.Is(err, redact.ErrNoHashKey) {
+		return nil, fmt.Errorf("OCT_REDACT_HASH_KEY must be set: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCT_REDACT: %w", err)
+	}
+	r.logger.Info("Redaction enabled", "detectors", builtins, "custom_rules", len(custom), "mode", string(mode))
+	return redactor, nil
+}
+
+// listen opens the TCP and Unix socket listeners that are enabled. Both serve
+// the same handlers.
+func (r *Runtime) listen(socketMode os.FileMode) ([]net.Listener, error) {
+	var listeners []net.Listener
+	if r.cfg.TCPEnabled {
+		ln, err := net.Listen("tcp", r.tcpAddr())
+		if err != nil {
+			return nil, fmt.Errorf("listen tcp: %w", err)
+		}
+		listeners = append(listeners, ln)
+	}
+	if r.cfg.UnixSocketPath != "" {
+		ln, err := server.ListenUnix(r.cfg.UnixSocketPath, socketMode)
+		if err != nil {
+			for _, open := range listeners {
+				_ = open.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
 func (r *Runtime) Snapshot() server.RuntimeSnapshot {
 	var lastPush *int64
 	if ts := r.lastPushTime.Load(); ts > 0 {
@@ -122,18 +394,81 @@ func (r *Runtime) Snapshot() server.RuntimeSnapshot {
 		lastPushStatus = s
 	}
 
+	var duplicates, deadLettered, workerRestarts int64
+	var workerState, workerError string
+	var workerFailing bool
+	if r.worker != nil {
+		duplicates = r.worker.Duplicates()
+		deadLettered = r.worker.DeadLettered()
+		workerState = string(r.worker.State())
+		workerRestarts = r.worker.Restarts()
+		workerFailing = r.worker.Failing()
+		workerError = r.worker.LastError()
+	}
+	var streamsOpen, streamsAbandoned int64
+	if r.streams != nil {
+		streamsOpen = int64(r.streams.Open())
+		streamsAbandoned = r.streams.Abandoned()
+	}
+	var udp *server.UDPStats
+	if r.udp != nil {
+		stats := r.udp.Stats()
+		udp = &stats
+	}
+	var spill *ingest.SpillStats
+	if r.spill != nil {
+		stats := r.spill.Stats()
+		spill = &stats
+	}
+	var sampling *ingest.SampleStats
+	if r.sampler != nil {
+		stats := r.sampler.Stats()
+		sampling = &stats
+	}
+	var redactionHits map[string]int64
+	if r.redactor != nil {
+		redactionHits = r.redactor.Hits()
+	}
+	var policy string
+	if r.backpressure != nil {
+		policy = string(r.backpressure.Policy())
+	}
+
+	r.droppedMu.Lock()
+	droppedByKind := make(map[string]int64, len(r.droppedByKind))
+	for kind, n := range r.droppedByKind {
+		droppedByKind[string(kind)] = n
+	}
+	r.droppedMu.Unlock()
+
 	return server.RuntimeSnapshot{
-		QueueDepth:     int64(len(r.ingestCh)),
-		EventsReceived: r.eventsReceived.Load(),
-		EventsDropped:  r.eventsDropped.Load(),
-		LastPushTime:   lastPush,
-		LastPushStatus: lastPushStatus,
+		QueueDepth:         int64(r.queueDepth()),
+		QueuePolicy:        policy,
+		EventsReceived:     r.eventsReceived.Load(),
+		EventsDropped:      r.eventsDropped.Load(),
+		EventsFiltered:     r.eventsFiltered.Load(),
+		DroppedByKind:      droppedByKind,
+		EventsDuplicate:    duplicates,
+		EventsDeadLettered: deadLettered,
+		WorkerState:        workerState,
+		WorkerRestarts:     workerRestarts,
+		WorkerFailing:      workerFailing,
+		WorkerLastError:    workerError,
+		StreamsOpen:        streamsOpen,
+		StreamsAbandoned:   streamsAbandoned,
+		UDP:                udp,
+		Spill:              spill,
+		Sampling:           sampling,
+		RedactionHits:      redactionHits,
+		SecurityLeaks:      r.securityLeaks.Load(),
+		LastPushTime:       lastPush,
+		LastPushStatus:     lastPushStatus,
 	}
 }
 
 func (r *Runtime) shutdown(ctx context.Context) error {
 	var joined error
-	r.logger.Info("Draining ingest channel", "remaining", len(r.ingestCh))
+	r.logger.Info("Draining ingest channel", "remaining", r.queueDepth())
 
 	if r.httpServer != nil {
 		httpCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -159,10 +494,29 @@ func (r *Runtime) shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Streams still open are recorded as abandoned rather than lost.
+	if r.streams != nil {
+		events := r.streams.Flush(time.Now())
+		for _, ev := range events {
+			r.Enqueue(ev)
+		}
+		if len(events) > 0 {
+			r.logger.Info("Recorded open streams as abandoned", "count", len(events)/2)
+		}
+	}
+
+	// Events arriving from here on, such as a proxied stream outliving the
+	// HTTP shutdown, are counted as dropped.
+	r.ingestMu.Lock()
+	ingestCh := r.ingestCh
 	if r.ingestCh != nil {
 		close(r.ingestCh)
 		r.ingestCh = nil
 	}
+	r.ingestMu.Unlock()
+	if r.workerStop != nil {
+		r.workerStop()
+	}
 	if r.workerDone != nil {
 		select {
 		case err := <-r.workerDone:
@@ -170,7 +524,30 @@ func (r *Runtime) shutdown(ctx context.Context) error {
 				joined = errors.Join(joined, fmt.Errorf("worker shutdown: %w", err))
 			}
 		case <-time.After(5 * time.Second):
-			joined = errors.Join(joined, errors.New("worker drain timeout"))
+			// The worker may still be reading the channel and writing to the
+			// spill and the database, so none of them is touched; SQLite and
+			// the spill recover from being left open at exit.
+			r.logger.Error("Worker did not stop, leaving queue, spill and database as they are", "remaining", len(ingestCh))
+			return errors.Join(joined, errors.New("worker drain timeout"))
+		}
+	}
+	if r.spill != nil {
+		// Whatever the worker did not reach is kept for the next start.
+		spilled := 0
+		if ingestCh != nil {
+			for ev := range ingestCh {
+				if err := r.spill.Append(ev); err != nil {
+					r.countDropped(ev.Kind)
+					continue
+				}
+				spilled++
+			}
+		}
+		if spilled > 0 {
+			r.logger.Info("Spilled undrained events", "count", spilled)
+		}
+		if err := r.spill.Close(); err != nil {
+			joined = errors.Join(joined, fmt.Errorf("spill close: %w", err))
 		}
 	}
 
@@ -203,18 +580,76 @@ func (r *Runtime) shutdown(ctx context.Context) error {
 }
 
 func (r *Runtime) Enqueue(event ingest.Event) bool {
+	// Leaks are looked for before redaction, which may mask the very keys
+	// being reported.
+	var leaks []redact.Leak
+	if r.cfg.LeakScan && event.Trace != nil {
+		if leaks = redact.FindLeaks(event.Trace); len(leaks) > 0 && event.TraceID == "" {
+			event.TraceID = uuid.NewString()
+		}
+	}
+	// The chain follows the leak scan so that sampled-out text is still
+	// checked. Redacting in it, before the queue, keeps personal data out of
+	// the spill and dead letters as well as the database.
+	// A processor dropping the event is not a failure to accept it.
+	ok := true
+	if r.processors.Process(&event) {
+		ok = r.queue(event)
+	} else {
+		r.eventsFiltered.Add(1)
+	}
+	if len(leaks) > 0 {
+		r.reportLeaks(event.TraceID, event.Trace, leaks)
+	}
+	return ok
+}
+
+func (r *Runtime) queue(event ingest.Event) bool {
+	r.ingestMu.RLock()
+	defer r.ingestMu.RUnlock()
 	if r.ingestCh == nil {
-		r.eventsDropped.Add(1)
+		r.countDropped(event.Kind)
 		return false
 	}
-	if ingest.TryEnqueue(r.ingestCh, event) {
+	ok, evicted := r.backpressure.Enqueue(r.ingestCh, event)
+	for _, ev := range evicted {
+		r.countDropped(ev.Kind)
+	}
+	if ok {
 		r.eventsReceived.Add(1)
 		return true
 	}
-	r.eventsDropped.Add(1)
+	r.countDropped(event.Kind)
 	return false
 }
 
+// reportLeaks queues the security_leak error for a trace. The event carries
+// only detector names and offsets; it goes through the processors like any
+// other so that it gets the same labels.
+func (r *Runtime) reportLeaks(traceID string, trace *ingest.TracePayload, leaks []redact.Leak) {
+	r.securityLeaks.Add(int64(len(leaks)))
+	r.logger.Warn("Credential detected in trace", "trace_id", traceID, "leaks", len(leaks))
+	event := redact.LeakEvent(traceID, trace, leaks, time.Now().UnixMilli())
+	if r.processors.Process(&event) {
+		r.queue(event)
+	} else {
+		r.eventsFiltered.Add(1)
+	}
+}
+
+func (r *Runtime) queueDepth() int {
+	r.ingestMu.RLock()
+	defer r.ingestMu.RUnlock()
+	return len(r.ingestCh)
+}
+
+func (r *Runtime) countDropped(kind ingest.EventKind) {
+	r.eventsDropped.Add(1)
+	r.droppedMu.Lock()
+	r.droppedByKind[kind]++
+	r.droppedMu.Unlock()
+}
+
 func (r *Runtime) startBackgroundLoops(ctx context.Context) {
 	collector := metrics.NewCollector(r.cfg.MetricsInterval, r, r.cfg.DBPath)
 	r.bgWG.Add(1)
@@ -225,6 +660,24 @@ func (r *Runtime) startBackgroundLoops(ctx context.Context) {
 		}
 	}()
 
+	r.bgWG.Add(1)
+	go func() {
+		defer r.bgWG.Done()
+		if err := r.streams.Run(ctx); err != nil {
+			r.logger.Warn("stream sweeper stopped", "error", err)
+		}
+	}()
+
+	if r.udp != nil {
+		r.bgWG.Add(1)
+		go func() {
+			defer r.bgWG.Done()
+			if err := r.udp.Run(ctx, r.udpConn); err != nil {
+				r.logger.Warn("udp receiver stopped", "error", err)
+			}
+		}()
+	}
+
 	if r.cfg.LogPath != "" {
 		r.bgWG.Add(1)
 		go func() {
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/config"
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+	"github.com/kon-rad/openclaw-trace/internal/proxy"
+)
+
+func TestProxiedStreamFinishingDuringShutdownIsDropped(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, `data: {"model":"gpt-4o","choices":[{"delta":{"content":"Hel"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = io.WriteString(w, `data: {"choices":[{"delta":{"content":"lo"},"finish_reason":"stop"}]}`+"\n\ndata: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	r := New(&config.Config{}, slog.New(slog.NewJSONHandler(io.Discard, nil)), "test")
+	// A full queue under the block policy keeps the late trace waiting to be
+	// sent while shutdown closes the channel.
+	r.backpressure = ingest.NewBackpressure(ingest.PolicyBlock, 500*time.Millisecond)
+	r.ingestCh = make(chan ingest.Event, 1)
+	r.ingestCh <- ingest.Event{Kind: ingest.EventKindCustom}
+	p, err := proxy.New(r, map[string]string{"openai": upstream.URL})
+	if err != nil {
+		t.Fatalf("new proxy: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	r.httpServer = &http.Server{Handler: p}
+	go func() { _ = r.httpServer.Serve(ln) }()
+
+	resp, err := http.Post("http://"+ln.Addr().String()+"/proxy/openai/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// The stream finishes once shutdown has started and outlives the HTTP
+	// shutdown, so the ingest channel is closed while the trace is queued.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- r.shutdown(ctx) }()
+	close(release)
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "[DONE]") {
+		t.Fatalf("stream not relayed: %q", body)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("shutdown did not finish")
+	}
+	if got := r.eventsDropped.Load(); got != 1 {
+		t.Fatalf("dropped = %d, want the late trace counted", got)
+	}
+}
@@ -11,6 +11,12 @@ import (
 
 type Config struct {
 	Port                   string        `env:"OCT_PORT,default=9090"`
+	BindAddr               string        `env:"OCT_BIND_ADDR"`
+	TCPEnabled             bool          `env:"OCT_TCP_ENABLED,default=true"`
+	UnixSocketPath         string        `env:"OCT_UNIX_SOCKET_PATH"`
+	UnixSocketMode         string        `env:"OCT_UNIX_SOCKET_MODE,default=0660"`
+	UDPAddr                string        `env:"OCT_UDP_ADDR"`
+	UDPMaxDatagramBytes    int           `env:"OCT_UDP_MAX_DATAGRAM_BYTES,default=8192"`
 	DBPath                 string        `env:"OCT_DB_PATH,default=/data/openclaw-trace.db"`
 	LogLevel               string        `env:"OCT_LOG_LEVEL,default=info"`
 	PushEndpoint           string        `env:"OCT_PUSH_ENDPOINT"`
@@ -19,12 +25,41 @@ type Config struct {
 	LogPath                string        `env:"OCT_LOG_PATH"`
 	RetentionDays          int           `env:"OCT_RETENTION_DAYS,default=3"`
 	MaxTextBytes           int           `env:"OCT_MAX_TEXT_BYTES,default=16384"`
+	TruncateMode           string        `env:"OCT_TRUNCATE_MODE,default=head"`
+	PromptStore            string        `env:"OCT_PROMPT_STORE,default=inline"`
+	PromptStoreMinBytes    int           `env:"OCT_PROMPT_STORE_MIN_BYTES,default=1024"`
+	CompressMinBytes       int           `env:"OCT_COMPRESS_MIN_BYTES,default=0"`
+	Processors             string        `env:"OCT_PROCESSORS"`
+	HostLabels             string        `env:"OCT_HOST_LABELS"`
+	FieldDefaults          string        `env:"OCT_FIELD_DEFAULTS"`
+	SampleRate             float64       `env:"OCT_SAMPLE_RATE,default=1"`
+	SampleTier             string        `env:"OCT_SAMPLE_TIER,default=metadata"`
+	SampleRules            string        `env:"OCT_SAMPLE_RULES"`
+	SampleKeepSlowestPct   float64       `env:"OCT_SAMPLE_KEEP_SLOWEST_PCT,default=0"`
+	Redact                 string        `env:"OCT_REDACT"`
+	RedactMode             string        `env:"OCT_REDACT_MODE,default=mask"`
+	RedactRules            string        `env:"OCT_REDACT_RULES"`
+	RedactHashKey          string        `env:"OCT_REDACT_HASH_KEY"`
+	LeakScan               bool          `env:"OCT_LEAK_SCAN,default=true"`
 	MetricsInterval        time.Duration `env:"OCT_METRICS_INTERVAL,default=15s"`
 	CleanupInterval        time.Duration `env:"OCT_CLEANUP_INTERVAL,default=5m"`
 	WALCheckpointInterval  time.Duration `env:"OCT_WAL_CHECKPOINT_INTERVAL,default=10m"`
 	WALRestartThresholdB   int64         `env:"OCT_WAL_RESTART_THRESHOLD_BYTES,default=52428800"`
 	CleanupDiskThreshold   float64       `env:"OCT_CLEANUP_DISK_THRESHOLD,default=80"`
 	CleanupDBThresholdByte int64         `env:"OCT_CLEANUP_DB_THRESHOLD_BYTES,default=104857600"`
+	MaxClockSkew           time.Duration `env:"OCT_MAX_CLOCK_SKEW,default=5m"`
+	MaxEventAge            time.Duration `env:"OCT_MAX_EVENT_AGE,default=168h"`
+	AuthTokens             string        `env:"OCT_AUTH_TOKENS"`
+	AllowedCIDRs           string        `env:"OCT_ALLOWED_CIDRS"`
+	HealthAuth             bool          `env:"OCT_HEALTH_AUTH,default=false"`
+	QueueFullPolicy        string        `env:"OCT_QUEUE_FULL_POLICY,default=drop"`
+	QueueBlockTimeout      time.Duration `env:"OCT_QUEUE_BLOCK_TIMEOUT,default=50ms"`
+	SpillMaxBytes          int64         `env:"OCT_SPILL_MAX_BYTES,default=67108864"`
+	StreamTimeout          time.Duration `env:"OCT_STREAM_TIMEOUT,default=5m"`
+	ProxyEnabled           bool          `env:"OCT_PROXY_ENABLED,default=false"`
+	ProxyOpenAIURL         string        `env:"OCT_PROXY_OPENAI_URL,default=https://api.openai.com"`
+	ProxyAnthropicURL      string        `env:"OCT_PROXY_ANTHROPIC_URL,default=https://api.anthropic.com"`
+	ProxyGeminiURL         string        `env:"OCT_PROXY_GEMINI_URL,default=https://generativelanguage.googleapis.com"`
 }
 
 func Load(ctx context.Context) (*Config, error) {
@@ -39,6 +74,12 @@ func WriteHelp(w io.Writer, version string) {
 	fmt.Fprintf(w, "openclaw-trace %s\n\n", version)
 	fmt.Fprintln(w, "Environment variables:")
 	fmt.Fprintln(w, "  OCT_PORT=9090")
+	fmt.Fprintln(w, "  OCT_BIND_ADDR=   (e.g. 127.0.0.1; empty binds all interfaces)")
+	fmt.Fprintln(w, "  OCT_TCP_ENABLED=true")
+	fmt.Fprintln(w, "  OCT_UNIX_SOCKET_PATH=")
+	fmt.Fprintln(w, "  OCT_UNIX_SOCKET_MODE=0660")
+	fmt.Fprintln(w, "  OCT_UDP_ADDR=   (e.g. 127.0.0.1:9091)")
+	fmt.Fprintln(w, "  OCT_UDP_MAX_DATAGRAM_BYTES=8192")
 	fmt.Fprintln(w, "  OCT_DB_PATH=/data/openclaw-trace.db")
 	fmt.Fprintln(w, "  OCT_LOG_LEVEL=info")
 	fmt.Fprintln(w, "  OCT_PUSH_ENDPOINT=")
@@ -47,12 +88,41 @@ func WriteHelp(w io.Writer, version string) {
 	fmt.Fprintln(w, "  OCT_LOG_PATH=")
 	fmt.Fprintln(w, "  OCT_RETENTION_DAYS=3")
 	fmt.Fprintln(w, "  OCT_MAX_TEXT_BYTES=16384")
+	fmt.Fprintln(w, "  OCT_TRUNCATE_MODE=head   (head|head_tail)")
+	fmt.Fprintln(w, "  OCT_PROMPT_STORE=inline   (inline|whole|segments)")
+	fmt.Fprintln(w, "  OCT_PROMPT_STORE_MIN_BYTES=1024")
+	fmt.Fprintln(w, "  OCT_COMPRESS_MIN_BYTES=0   (0 disables compression)")
+	fmt.Fprintln(w, "  OCT_PROCESSORS=   (comma-separated, in order: host_labels,defaults,normalize)")
+	fmt.Fprintln(w, "  OCT_HOST_LABELS=   (key=value,...; host defaults to the hostname)")
+	fmt.Fprintln(w, "  OCT_FIELD_DEFAULTS=   (e.g. trace.provider=unknown,error.severity=error)")
+	fmt.Fprintln(w, "  OCT_SAMPLE_RATE=1   (share of successful traces that keep their text)")
+	fmt.Fprintln(w, "  OCT_SAMPLE_TIER=metadata   (metadata|drop, for traces not sampled)")
+	fmt.Fprintln(w, "  OCT_SAMPLE_RULES=   (JSON: [{\"provider\":\"openai\",\"model\":\"gpt-4o-mini*\",\"rate\":0.1,\"tier\":\"drop\"}])")
+	fmt.Fprintln(w, "  OCT_SAMPLE_KEEP_SLOWEST_PCT=0")
+	fmt.Fprintln(w, "  OCT_REDACT=   (all, or api_key,email,credit_card,phone; name:mode overrides the mode)")
+	fmt.Fprintln(w, "  OCT_REDACT_MODE=mask   (mask|hash|drop)")
+	fmt.Fprintln(w, "  OCT_REDACT_RULES=   (JSON: [{\"name\":\"ticket\",\"pattern\":\"TCK-[0-9]+\",\"mode\":\"hash\"}])")
+	fmt.Fprintln(w, "  OCT_REDACT_HASH_KEY=   (required when a rule uses hash mode)")
+	fmt.Fprintln(w, "  OCT_LEAK_SCAN=true   (raise a critical security_leak error for keys, JWTs and private keys in trace text)")
 	fmt.Fprintln(w, "  OCT_METRICS_INTERVAL=15s")
 	fmt.Fprintln(w, "  OCT_CLEANUP_INTERVAL=5m")
 	fmt.Fprintln(w, "  OCT_WAL_CHECKPOINT_INTERVAL=10m")
 	fmt.Fprintln(w, "  OCT_WAL_RESTART_THRESHOLD_BYTES=52428800")
 	fmt.Fprintln(w, "  OCT_CLEANUP_DISK_THRESHOLD=80")
 	fmt.Fprintln(w, "  OCT_CLEANUP_DB_THRESHOLD_BYTES=104857600")
+	fmt.Fprintln(w, "  OCT_MAX_CLOCK_SKEW=5m")
+	fmt.Fprintln(w, "  OCT_MAX_EVENT_AGE=168h")
+	fmt.Fprintln(w, "  OCT_AUTH_TOKENS=   (source:token,source:token)")
+	fmt.Fprintln(w, "  OCT_ALLOWED_CIDRS=   (e.g. 127.0.0.1/32,10.0.0.0/8)")
+	fmt.Fprintln(w, "  OCT_HEALTH_AUTH=false")
+	fmt.Fprintln(w, "  OCT_QUEUE_FULL_POLICY=drop   (drop|reject|block|evict; applies once the spill is full too)")
+	fmt.Fprintln(w, "  OCT_QUEUE_BLOCK_TIMEOUT=50ms")
+	fmt.Fprintln(w, "  OCT_SPILL_MAX_BYTES=67108864   (0 disables spill-to-disk)")
+	fmt.Fprintln(w, "  OCT_STREAM_TIMEOUT=5m")
+	fmt.Fprintln(w, "  OCT_PROXY_ENABLED=false")
+	fmt.Fprintln(w, "  OCT_PROXY_OPENAI_URL=https://api.openai.com")
+	fmt.Fprintln(w, "  OCT_PROXY_ANTHROPIC_URL=https://api.anthropic.com")
+	fmt.Fprintln(w, "  OCT_PROXY_GEMINI_URL=https://generativelanguage.googleapis.com")
 	fmt.Fprintln(w)
 	fmt.Fprintln(w, "Flags:")
 	fmt.Fprintln(w, "  --help")
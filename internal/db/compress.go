@@ -0,0 +1,114 @@
+package db
+
+import (
+	"bytes"
+	"compress/flate"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"modernc.org/sqlite"
+)
+
+// Compressed text is stored as a BLOB whose first byte names the format, so
+// other encodings can be added without rewriting old rows. Uncompressed text
+// stays a TEXT value.
+const (
+	formatDeflate byte = 1
+)
+
+// textFunc is the SQL function that reads a text column whether or not its
+// value was compressed. Every query that returns compressible columns wraps
+// them in it.
+const textFunc = "oct_text"
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(textFunc, 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		raw, ok := args[0].([]byte)
+		if !ok {
+			return args[0], nil
+		}
+		return decompressText(raw)
+	})
+}
+
+// CompressedSinceStart counts the values this process compressed for writing
+// since it started, including writes later rolled back. It says nothing about
+// rows stored by earlier runs.
+type CompressedSinceStart struct {
+	Values      int64   `json:"values"`
+	RawBytes    int64   `json:"raw_bytes"`
+	StoredBytes int64   `json:"stored_bytes"`
+	Ratio       float64 `json:"ratio"`
+}
+
+type compressionCounters struct {
+	values      atomic.Int64
+	rawBytes    atomic.Int64
+	storedBytes atomic.Int64
+}
+
+// SetCompression stores input_text, output_text, stack_trace and prompt blob
+// values of at least minBytes compressed. Zero turns compression off; rows
+// already compressed stay readable either way.
+func (m *Manager) SetCompression(minBytes int) {
+	m.compressMinBytes = minBytes
+}
+
+func (m *Manager) CompressionEnabled() bool {
+	return m.compressMinBytes > 0
+}
+
+func (m *Manager) CompressedSinceStart() CompressedSinceStart {
+	s := CompressedSinceStart{
+		Values:      m.compression.values.Load(),
+		RawBytes:    m.compression.rawBytes.Load(),
+		StoredBytes: m.compression.storedBytes.Load(),
+	}
+	if s.StoredBytes > 0 {
+		s.Ratio = float64(s.RawBytes) / float64(s.StoredBytes)
+	}
+	return s
+}
+
+// storedText returns the value to bind for a compressible text column: the
+// text itself, or a compressed BLOB when it is long enough and compression
+// saves space.
+func (m *Manager) storedText(s string) any {
+	if m.compressMinBytes <= 0 || len(s) < m.compressMinBytes {
+		return s
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(formatDeflate)
+	zw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return s
+	}
+	if _, err := io.WriteString(zw, s); err != nil || zw.Close() != nil {
+		return s
+	}
+	if buf.Len() >= len(s) {
+		return s
+	}
+	m.compression.values.Add(1)
+	m.compression.rawBytes.Add(int64(len(s)))
+	m.compression.storedBytes.Add(int64(buf.Len()))
+	return buf.Bytes()
+}
+
+func decompressText(raw []byte) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	switch raw[0] {
+	case formatDeflate:
+		out, err := io.ReadAll(flate.NewReader(bytes.NewReader(raw[1:])))
+		if err != nil {
+			return "", fmt.Errorf("inflate text: %w", err)
+		}
+		return string(out), nil
+	default:
+		return "", fmt.Errorf("unknown text format %d", raw[0])
+	}
+}
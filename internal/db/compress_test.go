@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedTextReadsBackTransparently(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+	dbm.SetCompression(256)
+
+	ctx := context.Background()
+	input := strings.Repeat("Summarize the quarterly report. ", 40)
+	output := strings.Repeat("Revenue grew in every region. ", 40)
+	stack := strings.Repeat("at agent.step (agent.go:42)\n", 40)
+	_, err = dbm.InsertBatch(ctx, Batch{
+		Traces: []TraceInsert{{
+			TraceID:    "99999999-9999-4999-8999-999999999999",
+			CreatedAt:  1,
+			Provider:   "openai",
+			Model:      "gpt-4o",
+			Status:     "ok",
+			InputText:  input,
+			OutputText: output,
+		}},
+		Errors: []ErrorInsert{{
+			TraceID:    "aaaaaaaa-0000-4000-8000-000000000000",
+			CreatedAt:  2,
+			ErrorType:  "tool_failure",
+			Message:    "short stays text",
+			StackTrace: stack,
+			Severity:   "error",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+
+	var inputType, outputType, stackType, messageType string
+	if err := dbm.reader.QueryRowContext(ctx, `SELECT typeof(input_text), typeof(output_text) FROM llm_traces`).Scan(&inputType, &outputType); err != nil {
+		t.Fatalf("query trace types: %v", err)
+	}
+	if err := dbm.reader.QueryRowContext(ctx, `SELECT typeof(stack_trace), typeof(message) FROM error_events`).Scan(&stackType, &messageType); err != nil {
+		t.Fatalf("query error types: %v", err)
+	}
+	if inputType != "blob" || outputType != "blob" || stackType != "blob" || messageType != "text" {
+		t.Fatalf("stored types = %s, %s, %s, %s", inputType, outputType, stackType, messageType)
+	}
+
+	trace, err := dbm.LatestTrace(ctx)
+	if err != nil || trace.InputText != input || trace.OutputText != output {
+		t.Fatalf("latest trace did not decompress: %v", err)
+	}
+	errRow, err := dbm.LatestError(ctx)
+	if err != nil || errRow.StackTrace != stack {
+		t.Fatalf("latest error did not decompress: %v", err)
+	}
+
+	events, err := dbm.FetchUnsyncedEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("fetch unsynced: %v", err)
+	}
+	var tracePayload, errorPayload map[string]any
+	if err := json.Unmarshal(events[0].Data, &tracePayload); err != nil {
+		t.Fatalf("decode trace payload: %v", err)
+	}
+	if err := json.Unmarshal(events[1].Data, &errorPayload); err != nil {
+		t.Fatalf("decode error payload: %v", err)
+	}
+	if tracePayload["input_text"] != input || tracePayload["output_text"] != output || errorPayload["stack_trace"] != stack {
+		t.Fatalf("push payloads did not decompress")
+	}
+
+	stats := dbm.CompressedSinceStart()
+	if stats.Values != 3 || stats.Ratio <= 1 {
+		t.Fatalf("compression stats = %+v", stats)
+	}
+}
+
+func TestCompressedPromptBlobsRebuildInput(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+	dbm.SetPromptStore(PromptStoreSegments, 64)
+	dbm.SetCompression(64)
+
+	input := `[{"role":"system","content":"` + strings.Repeat("Follow the house style. ", 20) + `"},{"role":"user","content":"go"}]`
+	if _, err := dbm.InsertBatch(context.Background(), Batch{Traces: []TraceInsert{{
+		TraceID:   "bbbbbbbb-0000-4000-8000-000000000000",
+		CreatedAt: 1,
+		Provider:  "openai",
+		Model:     "gpt-4o",
+		Status:    "ok",
+		InputText: input,
+	}}}); err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+	if _, got, _, err := dbm.LatestTraceTexts(context.Background()); err != nil || got != input {
+		t.Fatalf("rebuilt input = %q, %v", got, err)
+	}
+}
+
+func TestDecompressTextRejectsUnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	if _, err := decompressText([]byte{0x7f, 'x'}); err == nil {
+		t.Fatalf("expected an error for an unknown format byte")
+	}
+}
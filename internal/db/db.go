@@ -18,6 +18,11 @@ type Manager struct {
 	path   string
 	writer *sql.DB
 	reader *sql.DB
+
+	promptStore         PromptStoreMode
+	promptStoreMinBytes int
+	compressMinBytes    int
+	compression         compressionCounters
 }
 
 type HealthStats struct {
@@ -87,6 +92,16 @@ func Open(path string) (*Manager, error) {
 		_ = reader.Close()
 		return nil, fmt.Errorf("apply schema: %w", err)
 	}
+	if err := migrateColumns(writer); err != nil {
+		_ = writer.Close()
+		_ = reader.Close()
+		return nil, fmt.Errorf("migrate schema: %w", err)
+	}
+	if _, err := writer.Exec(indexDDL); err != nil {
+		_ = writer.Close()
+		_ = reader.Close()
+		return nil, fmt.Errorf("apply indexes: %w", err)
+	}
 
 	return &Manager{
 		path:   path,
@@ -153,7 +168,10 @@ func (m *Manager) UnsyncedCount(ctx context.Context) (int64, error) {
 SELECT
   (SELECT COUNT(*) FROM llm_traces WHERE synced = 0) +
   (SELECT COUNT(*) FROM error_events WHERE synced = 0) +
-  (SELECT COUNT(*) FROM system_metrics WHERE synced = 0)
+  (SELECT COUNT(*) FROM system_metrics WHERE synced = 0) +
+  (SELECT COUNT(*) FROM custom_events WHERE synced = 0) +
+  (SELECT COUNT(*) FROM tool_calls WHERE synced = 0) +
+  (SELECT COUNT(*) FROM sampled_out WHERE synced = 0)
 `
 	var count int64
 	if err := m.reader.QueryRowContext(ctx, query).Scan(&count); err != nil {
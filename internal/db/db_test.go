@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"path/filepath"
 	"testing"
 )
@@ -40,3 +41,66 @@ func TestOpenAppliesPragmasAndSchema(t *testing.T) {
 		t.Fatalf("unsynced count = %d, want 0", unsynced)
 	}
 }
+
+func TestOpenMigratesLegacyTraceTable(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "trace.db")
+	legacy, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatalf("open legacy db: %v", err)
+	}
+	_, err = legacy.Exec(`
+CREATE TABLE llm_traces (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  trace_id TEXT NOT NULL UNIQUE,
+  created_at INTEGER NOT NULL,
+  provider TEXT NOT NULL,
+  model TEXT NOT NULL,
+  input_text TEXT,
+  output_text TEXT,
+  prompt_tokens INTEGER,
+  completion_tokens INTEGER,
+  total_tokens INTEGER,
+  cost_usd REAL,
+  latency_ms INTEGER,
+  status TEXT NOT NULL DEFAULT 'ok',
+  error_type TEXT,
+  metadata TEXT,
+  synced INTEGER NOT NULL DEFAULT 0,
+  pushed_at INTEGER
+);
+INSERT INTO llm_traces (trace_id, created_at, provider, model, prompt_tokens, completion_tokens, total_tokens, cost_usd, latency_ms)
+VALUES ('legacy', 1, 'anthropic', 'claude', 1, 1, 2, 0, 10);
+`)
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+	_ = legacy.Close()
+
+	dbm, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer func() {
+		_ = dbm.Close()
+	}()
+
+	for _, m := range columnMigrations {
+		exists, err := columnExists(dbm.writer, m.table, m.column)
+		if err != nil {
+			t.Fatalf("column lookup: %v", err)
+		}
+		if !exists {
+			t.Fatalf("column %s.%s was not migrated", m.table, m.column)
+		}
+	}
+
+	row, err := dbm.LatestTrace(context.Background())
+	if err != nil {
+		t.Fatalf("latest trace after migration: %v", err)
+	}
+	if row.TraceID != "legacy" || row.SessionID != "" {
+		t.Fatalf("unexpected legacy row: %+v", row)
+	}
+}
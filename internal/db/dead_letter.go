@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DeadLetterInsert is an event that could not be stored. Payload is the event
+// encoded as JSON so it can be inspected or replayed by hand.
+type DeadLetterInsert struct {
+	CreatedAt int64
+	Kind      string
+	TraceID   string
+	Payload   string
+	Error     string
+}
+
+type DeadLetterRow struct {
+	ID        int64
+	CreatedAt int64
+	Kind      string
+	TraceID   string
+	Payload   string
+	Error     string
+}
+
+// blobRefAbort starts the message of a trigger abort raised over prompt blob
+// references. Those depend on the blobs other traces hold, not on the row
+// being written, so the write is retried.
+const blobRefAbort = "prompt blob ref"
+
+// IsDataError reports whether err was caused by the rows being written, such
+// as a constraint violation or a trigger rejecting a row, rather than by the
+// database. Retrying the same rows after a data error cannot succeed.
+func IsDataError(err error) bool {
+	var serr *sqlite.Error
+	if !errors.As(err, &serr) {
+		return false
+	}
+	if serr.Code() == sqlite3.SQLITE_CONSTRAINT_TRIGGER {
+		return !strings.Contains(serr.Error(), blobRefAbort)
+	}
+	switch serr.Code() & 0xff {
+	case sqlite3.SQLITE_CONSTRAINT, sqlite3.SQLITE_MISMATCH, sqlite3.SQLITE_TOOBIG:
+		return true
+	default:
+		return false
+	}
+}
+
+// InsertDeadLetters stores rows, skipping any whose trace id is already
+// dead-lettered so a retried batch does not record the same event twice.
+func (m *Manager) InsertDeadLetters(ctx context.Context, rows []DeadLetterInsert) error {
+	tx, err := m.writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, row := range rows {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO dead_letter (created_at, kind, trace_id, payload, error)
+VALUES (?, ?, NULLIF(?, ''), ?, ?)
+ON CONFLICT (trace_id) DO NOTHING
+`, row.CreatedAt, row.Kind, row.TraceID, row.Payload, row.Error); err != nil {
+			return fmt.Errorf("insert dead letter: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit dead letters: %w", err)
+	}
+	return nil
+}
+
+// ListDeadLetters returns up to limit dead letters, newest first. A positive
+// beforeID continues a previous page.
+func (m *Manager) ListDeadLetters(ctx context.Context, limit int, beforeID int64) ([]DeadLetterRow, error) {
+	query := `SELECT id, created_at, kind, COALESCE(trace_id, ''), payload, error FROM dead_letter`
+	args := []any{}
+	if beforeID > 0 {
+		query += ` WHERE id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := m.reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DeadLetterRow{}
+	for rows.Next() {
+		var row DeadLetterRow
+		if err := rows.Scan(&row.ID, &row.CreatedAt, &row.Kind, &row.TraceID, &row.Payload, &row.Error); err != nil {
+			return nil, fmt.Errorf("scan dead letter: %w", err)
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// PurgeDeadLetters deletes the dead letters with the given ids, or all of
+// them when ids is empty.
+func (m *Manager) PurgeDeadLetters(ctx context.Context, ids []int64) (int64, error) {
+	query := `DELETE FROM dead_letter`
+	args := make([]any, 0, len(ids))
+	if len(ids) > 0 {
+		query += ` WHERE id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	res, err := m.writer.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("purge dead letters: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (m *Manager) DeadLetterCount(ctx context.Context) (int64, error) {
+	var n int64
+	if err := m.reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM dead_letter`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count dead letters: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterListPagesAndPurges(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ctx := context.Background()
+	var rows []DeadLetterInsert
+	for i := range 5 {
+		rows = append(rows, DeadLetterInsert{
+			CreatedAt: time.Now().UnixMilli(),
+			Kind:      "custom",
+			TraceID:   fmt.Sprintf("t%d", i),
+			Payload:   `{}`,
+			Error:     "constraint failed",
+		})
+	}
+	if err := dbm.InsertDeadLetters(ctx, rows); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	// The same event dead-lettered again by a retried batch is skipped.
+	if err := dbm.InsertDeadLetters(ctx, rows[:1]); err != nil {
+		t.Fatalf("reinsert: %v", err)
+	}
+
+	page, err := dbm.ListDeadLetters(ctx, 3, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page) != 3 || page[0].TraceID != "t4" {
+		t.Fatalf("first page = %+v, want newest three", page)
+	}
+	rest, err := dbm.ListDeadLetters(ctx, 3, page[2].ID)
+	if err != nil {
+		t.Fatalf("list next page: %v", err)
+	}
+	if len(rest) != 2 || rest[1].TraceID != "t0" {
+		t.Fatalf("second page = %+v, want the oldest two", rest)
+	}
+
+	purged, err := dbm.PurgeDeadLetters(ctx, []int64{page[0].ID, page[1].ID})
+	if err != nil || purged != 2 {
+		t.Fatalf("purge ids = %d, %v; want 2", purged, err)
+	}
+	purged, err = dbm.PurgeDeadLetters(ctx, nil)
+	if err != nil || purged != 3 {
+		t.Fatalf("purge all = %d, %v; want 3", purged, err)
+	}
+	if n, err := dbm.DeadLetterCount(ctx); err != nil || n != 0 {
+		t.Fatalf("count after purge = %d, %v", n, err)
+	}
+}
+
+func TestIsDataErrorClassifiesTriggerAborts(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ctx := context.Background()
+	_, err = dbm.InsertBatch(ctx, Batch{CustomEvents: []CustomEventInsert{{TraceID: "c1", CreatedAt: 1, Name: "step", Attributes: "{not json"}}})
+	if err == nil || !IsDataError(err) {
+		t.Fatalf("check violation: err = %v, want a data error", err)
+	}
+
+	if _, err := dbm.writer.ExecContext(ctx, `CREATE TRIGGER reject_traces BEFORE INSERT ON llm_traces WHEN NEW.model = 'banned' BEGIN SELECT RAISE(ABORT, 'model not allowed'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	_, err = dbm.InsertBatch(ctx, Batch{Traces: []TraceInsert{{TraceID: "t1", CreatedAt: 1, Provider: "openai", Model: "banned", Status: "ok"}}})
+	if err == nil || !IsDataError(err) {
+		t.Fatalf("row rejected by trigger: err = %v, want a data error", err)
+	}
+
+	if _, err := dbm.writer.ExecContext(ctx, `CREATE TRIGGER fail_traces BEFORE INSERT ON llm_traces BEGIN SELECT RAISE(ABORT, '`+blobRefAbort+`: simulated outage'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	_, err = dbm.InsertBatch(ctx, Batch{Traces: []TraceInsert{{TraceID: "t2", CreatedAt: 1, Provider: "openai", Model: "gpt-4o", Status: "ok"}}})
+	if err == nil || IsDataError(err) {
+		t.Fatalf("blob ref abort: err = %v, want an error that is retried", err)
+	}
+}
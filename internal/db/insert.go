@@ -21,11 +21,35 @@ type TraceInsert struct {
 	Status           string
 	ErrorType        string
 	Metadata         string
+	SessionID        string
+	RunID            string
+	SpanID           string
+	ParentSpanID     string
+	StartedAt        int64
+	EndedAt          int64
+	TTFTMS           int
+	TokensPerSec     float64
+
+	// Truncation flags, byte lengths and hex SHA-256 digests of the texts
+	// as received, before they were cut to the stored size.
+	InputTruncated  bool
+	OutputTruncated bool
+	InputBytes      int
+	OutputBytes     int
+	InputSHA256     string
+	OutputSHA256    string
+	// TextDropped marks a trace stored without its texts by sampling.
+	TextDropped bool
+	// InputSegments are the messages of a truncated input, split before it
+	// was cut and each shortened on its own. The segments prompt store keeps
+	// them instead of InputText so they still match other traces' blobs.
+	InputSegments []string
 }
 
 type ErrorInsert struct {
 	TraceID    string
 	CreatedAt  int64
+	LLMTraceID string
 	ErrorType  string
 	Message    string
 	StackTrace string
@@ -46,6 +70,64 @@ type MetricInsert struct {
 	Metadata      string
 }
 
+type CustomEventInsert struct {
+	TraceID    string
+	CreatedAt  int64
+	Name       string
+	Attributes string
+	Metadata   string
+}
+
+type ToolCallInsert struct {
+	TraceID      string
+	CreatedAt    int64
+	LLMTraceID   string
+	ToolName     string
+	Arguments    string
+	ResultBytes  int64
+	DurationMS   int
+	Status       string
+	ErrorType    string
+	ErrorMessage string
+	Metadata     string
+	SessionID    string
+	RunID        string
+	SpanID       string
+	ParentSpanID string
+	StartedAt    int64
+	EndedAt      int64
+}
+
+// SampledOutInsert totals traces of one provider and model that sampling
+// left out, so that counts, tokens and cost stay complete.
+type SampledOutInsert struct {
+	TraceID          string
+	CreatedAt        int64
+	Provider         string
+	Model            string
+	Traces           int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CostUSD          float64
+}
+
+// Batch groups the rows written by a single InsertBatch transaction.
+type Batch struct {
+	Traces       []TraceInsert
+	Errors       []ErrorInsert
+	Metrics      []MetricInsert
+	CustomEvents []CustomEventInsert
+	ToolCalls    []ToolCallInsert
+	SampledOut   []SampledOutInsert
+}
+
+// InsertResult reports rows skipped because a row with the same trace_id
+// already exists, which happens when a client retries a delivered event.
+type InsertResult struct {
+	Duplicates int
+}
+
 type TraceRow struct {
 	TraceID          string
 	Provider         string
@@ -60,10 +142,30 @@ type TraceRow struct {
 	Status           string
 	ErrorType        string
 	Metadata         string
+	SessionID        string
+	RunID            string
+	SpanID           string
+	ParentSpanID     string
+	StartedAt        int64
+	EndedAt          int64
+	TTFTMS           int
+	TokensPerSec     float64
+
+	// Truncation flags, byte lengths and hex SHA-256 digests of the texts
+	// as received, before they were cut to the stored size.
+	InputTruncated  bool
+	OutputTruncated bool
+	InputBytes      int
+	OutputBytes     int
+	InputSHA256     string
+	OutputSHA256    string
+	// TextDropped marks a trace stored without its texts by sampling.
+	TextDropped bool
 }
 
 type ErrorRow struct {
 	TraceID    string
+	LLMTraceID string
 	ErrorType  string
 	Message    string
 	StackTrace string
@@ -71,37 +173,80 @@ type ErrorRow struct {
 	Metadata   string
 }
 
-func (m *Manager) InsertBatch(ctx context.Context, traces []TraceInsert, errs []ErrorInsert, metrics []MetricInsert) error {
+type CustomEventRow struct {
+	TraceID    string
+	Name       string
+	Attributes string
+	Metadata   string
+}
+
+type ToolCallRow struct {
+	TraceID      string
+	LLMTraceID   string
+	ToolName     string
+	Arguments    string
+	ResultBytes  int64
+	DurationMS   int
+	Status       string
+	ErrorType    string
+	ErrorMessage string
+	Metadata     string
+	SessionID    string
+	SpanID       string
+	StartedAt    int64
+	EndedAt      int64
+}
+
+func (m *Manager) InsertBatch(ctx context.Context, batch Batch) (InsertResult, error) {
+	var res InsertResult
 	tx, err := m.writer.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
+		return res, fmt.Errorf("begin tx: %w", err)
 	}
 	defer func() {
 		_ = tx.Rollback()
 	}()
 
-	if len(traces) > 0 {
+	if len(batch.Traces) > 0 {
 		stmt, err := tx.PrepareContext(ctx, `
 INSERT INTO llm_traces (
   trace_id, created_at, provider, model, input_text, output_text,
   prompt_tokens, completion_tokens, total_tokens, cost_usd, latency_ms,
-  status, error_type, metadata, synced, pushed_at
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, NULL)
+  status, error_type, metadata, session_id, run_id, span_id, parent_span_id,
+  started_at, ended_at, ttft_ms, tokens_per_sec,
+  input_truncated, output_truncated, input_bytes, output_bytes, input_sha256, output_sha256,
+  input_blobs, text_dropped, synced, pushed_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''),
+  NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+  NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0),
+  ?, ?, NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, ''), ?, ?, 0, NULL)
+ON CONFLICT (trace_id) DO NOTHING
 `)
 		if err != nil {
-			return fmt.Errorf("prepare trace insert: %w", err)
+			return res, fmt.Errorf("prepare trace insert: %w", err)
 		}
 		defer stmt.Close()
 
-		for _, row := range traces {
-			if _, err := stmt.ExecContext(
+		for _, row := range batch.Traces {
+			// Inputs moved to prompt_blobs leave input_text NULL.
+			var inputText, inputBlobs any
+			segments := m.promptSegments(row.InputText, row.InputSegments)
+			var hashes []string
+			if segments != nil {
+				var encoded string
+				hashes, encoded = hashSegments(segments)
+				inputBlobs = encoded
+			} else {
+				inputText = m.storedText(row.InputText)
+			}
+			result, err := stmt.ExecContext(
 				ctx,
 				row.TraceID,
 				row.CreatedAt,
 				row.Provider,
 				row.Model,
-				row.InputText,
-				row.OutputText,
+				inputText,
+				m.storedText(row.OutputText),
 				row.PromptTokens,
 				row.CompletionTokens,
 				row.TotalTokens,
@@ -110,53 +255,86 @@ INSERT INTO llm_traces (
 				row.Status,
 				row.ErrorType,
 				row.Metadata,
-			); err != nil {
-				return fmt.Errorf("insert trace row: %w", err)
+				row.SessionID,
+				row.RunID,
+				row.SpanID,
+				row.ParentSpanID,
+				row.StartedAt,
+				row.EndedAt,
+				row.TTFTMS,
+				row.TokensPerSec,
+				row.InputTruncated,
+				row.OutputTruncated,
+				row.InputBytes,
+				row.OutputBytes,
+				row.InputSHA256,
+				row.OutputSHA256,
+				inputBlobs,
+				row.TextDropped,
+			)
+			if err != nil {
+				return res, fmt.Errorf("insert trace row: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				res.Duplicates++
+				continue
+			}
+			for i, segment := range segments {
+				if err := m.addPromptBlobRef(ctx, tx, hashes[i], segment, row.CreatedAt); err != nil {
+					return res, err
+				}
 			}
 		}
 	}
 
-	if len(errs) > 0 {
+	if len(batch.Errors) > 0 {
 		stmt, err := tx.PrepareContext(ctx, `
 INSERT INTO error_events (
-  trace_id, created_at, error_type, message, stack_trace, severity, metadata, synced, pushed_at
-) VALUES (?, ?, ?, ?, ?, ?, ?, 0, NULL)
+  trace_id, created_at, llm_trace_id, error_type, message, stack_trace, severity, metadata, synced, pushed_at
+) VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, NULLIF(?, ''), 0, NULL)
+ON CONFLICT (trace_id) DO NOTHING
 `)
 		if err != nil {
-			return fmt.Errorf("prepare error insert: %w", err)
+			return res, fmt.Errorf("prepare error insert: %w", err)
 		}
 		defer stmt.Close()
 
-		for _, row := range errs {
-			if _, err := stmt.ExecContext(
+		for _, row := range batch.Errors {
+			result, err := stmt.ExecContext(
 				ctx,
 				row.TraceID,
 				row.CreatedAt,
+				row.LLMTraceID,
 				row.ErrorType,
 				row.Message,
-				row.StackTrace,
+				m.storedText(row.StackTrace),
 				row.Severity,
 				row.Metadata,
-			); err != nil {
-				return fmt.Errorf("insert error row: %w", err)
+			)
+			if err != nil {
+				return res, fmt.Errorf("insert error row: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				res.Duplicates++
 			}
 		}
 	}
 
-	if len(metrics) > 0 {
+	if len(batch.Metrics) > 0 {
 		stmt, err := tx.PrepareContext(ctx, `
 INSERT INTO system_metrics (
   trace_id, created_at, cpu_pct, mem_rss_bytes, mem_available, mem_total,
   disk_used_bytes, disk_total_bytes, disk_free_bytes, metadata, synced, pushed_at
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, NULL)
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), 0, NULL)
+ON CONFLICT (trace_id) DO NOTHING
 `)
 		if err != nil {
-			return fmt.Errorf("prepare metric insert: %w", err)
+			return res, fmt.Errorf("prepare metric insert: %w", err)
 		}
 		defer stmt.Close()
 
-		for _, row := range metrics {
-			if _, err := stmt.ExecContext(
+		for _, row := range batch.Metrics {
+			result, err := stmt.ExecContext(
 				ctx,
 				row.TraceID,
 				row.CreatedAt,
@@ -168,16 +346,131 @@ INSERT INTO system_metrics (
 				row.DiskTotal,
 				row.DiskFreeBytes,
 				row.Metadata,
+			)
+			if err != nil {
+				return res, fmt.Errorf("insert metric row: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				res.Duplicates++
+			}
+		}
+	}
+
+	if len(batch.CustomEvents) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO custom_events (
+  trace_id, created_at, name, attributes, metadata, synced, pushed_at
+) VALUES (?, ?, ?, ?, NULLIF(?, ''), 0, NULL)
+ON CONFLICT (trace_id) DO NOTHING
+`)
+		if err != nil {
+			return res, fmt.Errorf("prepare custom event insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, row := range batch.CustomEvents {
+			attributes := row.Attributes
+			if attributes == "" {
+				attributes = "{}"
+			}
+			result, err := stmt.ExecContext(
+				ctx,
+				row.TraceID,
+				row.CreatedAt,
+				row.Name,
+				attributes,
+				row.Metadata,
+			)
+			if err != nil {
+				return res, fmt.Errorf("insert custom event row: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				res.Duplicates++
+			}
+		}
+	}
+
+	if len(batch.ToolCalls) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO tool_calls (
+  trace_id, created_at, llm_trace_id, tool_name, arguments, result_bytes,
+  duration_ms, status, error_type, error_message, metadata,
+  session_id, run_id, span_id, parent_span_id, started_at, ended_at, synced, pushed_at
+) VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+  NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+  NULLIF(?, 0), NULLIF(?, 0), 0, NULL)
+ON CONFLICT (trace_id) DO NOTHING
+`)
+		if err != nil {
+			return res, fmt.Errorf("prepare tool call insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, row := range batch.ToolCalls {
+			result, err := stmt.ExecContext(
+				ctx,
+				row.TraceID,
+				row.CreatedAt,
+				row.LLMTraceID,
+				row.ToolName,
+				row.Arguments,
+				row.ResultBytes,
+				row.DurationMS,
+				row.Status,
+				row.ErrorType,
+				row.ErrorMessage,
+				row.Metadata,
+				row.SessionID,
+				row.RunID,
+				row.SpanID,
+				row.ParentSpanID,
+				row.StartedAt,
+				row.EndedAt,
+			)
+			if err != nil {
+				return res, fmt.Errorf("insert tool call row: %w", err)
+			}
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				res.Duplicates++
+			}
+		}
+	}
+
+	if len(batch.SampledOut) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO sampled_out (
+  trace_id, created_at, provider, model, traces,
+  prompt_tokens, completion_tokens, total_tokens, cost_usd, synced, pushed_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, NULL)
+ON CONFLICT (trace_id) DO NOTHING
+`)
+		if err != nil {
+			return res, fmt.Errorf("prepare sampled out insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, row := range batch.SampledOut {
+			if _, err := stmt.ExecContext(
+				ctx,
+				row.TraceID,
+				row.CreatedAt,
+				row.Provider,
+				row.Model,
+				row.Traces,
+				row.PromptTokens,
+				row.CompletionTokens,
+				row.TotalTokens,
+				row.CostUSD,
 			); err != nil {
-				return fmt.Errorf("insert metric row: %w", err)
+				return res, fmt.Errorf("insert sampled out row: %w", err)
 			}
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit tx: %w", err)
+		return res, fmt.Errorf("commit tx: %w", err)
 	}
-	return nil
+	return res, nil
 }
 
 func (m *Manager) TraceCount(ctx context.Context) (int64, error) {
@@ -204,10 +497,60 @@ func (m *Manager) MetricCount(ctx context.Context) (int64, error) {
 	return out, nil
 }
 
+func (m *Manager) CustomEventCount(ctx context.Context) (int64, error) {
+	var out int64
+	if err := m.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM custom_events").Scan(&out); err != nil {
+		return 0, err
+	}
+	return out, nil
+}
+
+func (m *Manager) ToolCallCount(ctx context.Context) (int64, error) {
+	var out int64
+	if err := m.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM tool_calls").Scan(&out); err != nil {
+		return 0, err
+	}
+	return out, nil
+}
+
+// SampledOutRow holds the sampled-out totals of one provider and model.
+type SampledOutRow struct {
+	Provider         string
+	Model            string
+	Traces           int64
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	CostUSD          float64
+}
+
+// SampledOutTotals sums the sampled-out rows per provider and model.
+func (m *Manager) SampledOutTotals(ctx context.Context) ([]SampledOutRow, error) {
+	rows, err := m.reader.QueryContext(ctx, `
+SELECT provider, model, SUM(traces), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(cost_usd)
+FROM sampled_out
+GROUP BY provider, model
+ORDER BY provider, model
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SampledOutRow
+	for rows.Next() {
+		var row SampledOutRow
+		if err := rows.Scan(&row.Provider, &row.Model, &row.Traces, &row.PromptTokens, &row.CompletionTokens, &row.TotalTokens, &row.CostUSD); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
 func (m *Manager) LatestTraceTexts(ctx context.Context) (traceID string, input string, output string, err error) {
 	err = m.reader.QueryRowContext(
 		ctx,
-		`SELECT trace_id, COALESCE(input_text,''), COALESCE(output_text,'') FROM llm_traces ORDER BY id DESC LIMIT 1`,
+		`SELECT trace_id, COALESCE(`+inputTextSQL+`,''), COALESCE(`+textFunc+`(output_text),'') FROM llm_traces ORDER BY id DESC LIMIT 1`,
 	).Scan(&traceID, &input, &output)
 	return
 }
@@ -215,7 +558,11 @@ func (m *Manager) LatestTraceTexts(ctx context.Context) (traceID string, input s
 func (m *Manager) LatestTrace(ctx context.Context) (TraceRow, error) {
 	var row TraceRow
 	err := m.reader.QueryRowContext(ctx, `
-SELECT trace_id, provider, model, COALESCE(input_text,''), COALESCE(output_text,''), prompt_tokens, completion_tokens, total_tokens, cost_usd, latency_ms, status, COALESCE(error_type,''), COALESCE(metadata,'')
+SELECT trace_id, provider, model, COALESCE(`+inputTextSQL+`,''), COALESCE(`+textFunc+`(output_text),''), prompt_tokens, completion_tokens, total_tokens, cost_usd, latency_ms, status, COALESCE(error_type,''), COALESCE(metadata,''),
+  COALESCE(session_id,''), COALESCE(run_id,''), COALESCE(span_id,''), COALESCE(parent_span_id,''),
+  COALESCE(started_at,0), COALESCE(ended_at,0), COALESCE(ttft_ms,0), COALESCE(tokens_per_sec,0),
+  input_truncated, output_truncated, COALESCE(input_bytes,0), COALESCE(output_bytes,0),
+  COALESCE(input_sha256,''), COALESCE(output_sha256,''), text_dropped
 FROM llm_traces
 ORDER BY id DESC LIMIT 1
 `).Scan(
@@ -232,6 +579,21 @@ ORDER BY id DESC LIMIT 1
 		&row.Status,
 		&row.ErrorType,
 		&row.Metadata,
+		&row.SessionID,
+		&row.RunID,
+		&row.SpanID,
+		&row.ParentSpanID,
+		&row.StartedAt,
+		&row.EndedAt,
+		&row.TTFTMS,
+		&row.TokensPerSec,
+		&row.InputTruncated,
+		&row.OutputTruncated,
+		&row.InputBytes,
+		&row.OutputBytes,
+		&row.InputSHA256,
+		&row.OutputSHA256,
+		&row.TextDropped,
 	)
 	return row, err
 }
@@ -239,11 +601,12 @@ ORDER BY id DESC LIMIT 1
 func (m *Manager) LatestError(ctx context.Context) (ErrorRow, error) {
 	var row ErrorRow
 	err := m.reader.QueryRowContext(ctx, `
-SELECT trace_id, error_type, message, COALESCE(stack_trace,''), severity, COALESCE(metadata,'')
+SELECT trace_id, COALESCE(llm_trace_id,''), error_type, message, COALESCE(`+textFunc+`(stack_trace),''), severity, COALESCE(metadata,'')
 FROM error_events
 ORDER BY id DESC LIMIT 1
 `).Scan(
 		&row.TraceID,
+		&row.LLMTraceID,
 		&row.ErrorType,
 		&row.Message,
 		&row.StackTrace,
@@ -253,6 +616,48 @@ ORDER BY id DESC LIMIT 1
 	return row, err
 }
 
+func (m *Manager) LatestCustomEvent(ctx context.Context) (CustomEventRow, error) {
+	var row CustomEventRow
+	err := m.reader.QueryRowContext(ctx, `
+SELECT trace_id, name, attributes, COALESCE(metadata,'')
+FROM custom_events
+ORDER BY id DESC LIMIT 1
+`).Scan(
+		&row.TraceID,
+		&row.Name,
+		&row.Attributes,
+		&row.Metadata,
+	)
+	return row, err
+}
+
+func (m *Manager) LatestToolCall(ctx context.Context) (ToolCallRow, error) {
+	var row ToolCallRow
+	err := m.reader.QueryRowContext(ctx, `
+SELECT trace_id, COALESCE(llm_trace_id,''), tool_name, COALESCE(arguments,''), COALESCE(result_bytes,0),
+  COALESCE(duration_ms,0), status, COALESCE(error_type,''), COALESCE(error_message,''), COALESCE(metadata,''),
+  COALESCE(session_id,''), COALESCE(span_id,''), COALESCE(started_at,0), COALESCE(ended_at,0)
+FROM tool_calls
+ORDER BY id DESC LIMIT 1
+`).Scan(
+		&row.TraceID,
+		&row.LLMTraceID,
+		&row.ToolName,
+		&row.Arguments,
+		&row.ResultBytes,
+		&row.DurationMS,
+		&row.Status,
+		&row.ErrorType,
+		&row.ErrorMessage,
+		&row.Metadata,
+		&row.SessionID,
+		&row.SpanID,
+		&row.StartedAt,
+		&row.EndedAt,
+	)
+	return row, err
+}
+
 func (m *Manager) ErrorCountByType(ctx context.Context, errorType string) (int64, error) {
 	var out int64
 	if err := m.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM error_events WHERE error_type = ?", errorType).Scan(&out); err != nil {
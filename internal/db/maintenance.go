@@ -43,7 +43,7 @@ func (m *Manager) CleanupOldSynced(ctx context.Context, retentionDays int, diskT
 	}
 
 	cutoff := time.Now().Add(-time.Duration(retentionDays) * 24 * time.Hour).UnixMilli()
-	tables := []string{"llm_traces", "error_events", "system_metrics"}
+	tables := []string{"llm_traces", "error_events", "system_metrics", "custom_events", "tool_calls", "sampled_out"}
 	for _, table := range tables {
 		res, execErr := m.writer.ExecContext(ctx, "DELETE FROM "+table+" WHERE synced = 1 AND created_at < ?", cutoff)
 		if execErr != nil {
@@ -52,6 +52,13 @@ func (m *Manager) CleanupOldSynced(ctx context.Context, retentionDays int, diskT
 		affected, _ := res.RowsAffected()
 		deleted += affected
 	}
+	// Dead letters are never pushed, so they age out unconditionally.
+	res, err := m.writer.ExecContext(ctx, "DELETE FROM dead_letter WHERE created_at < ?", cutoff)
+	if err != nil {
+		return deleted, true, err
+	}
+	affected, _ := res.RowsAffected()
+	deleted += affected
 
 	_, _ = m.writer.ExecContext(ctx, "PRAGMA incremental_vacuum(1000)")
 	return deleted, true, nil
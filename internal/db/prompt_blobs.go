@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PromptStoreMode selects how trace inputs are stored.
+type PromptStoreMode string
+
+const (
+	// PromptStoreInline keeps every input in llm_traces.input_text.
+	PromptStoreInline PromptStoreMode = "inline"
+	// PromptStoreWhole stores each distinct input once in prompt_blobs.
+	PromptStoreWhole PromptStoreMode = "whole"
+	// PromptStoreSegments splits a JSON message array into its system
+	// prompt, history and new message, and stores each distinct segment
+	// once. Other inputs are stored whole.
+	PromptStoreSegments PromptStoreMode = "segments"
+)
+
+const DefaultPromptStoreMinBytes = 1024
+
+func ParsePromptStoreMode(s string) (PromptStoreMode, error) {
+	switch m := PromptStoreMode(s); m {
+	case PromptStoreInline, PromptStoreWhole, PromptStoreSegments:
+		return m, nil
+	case "":
+		return PromptStoreInline, nil
+	default:
+		return "", fmt.Errorf("unknown prompt store mode %q", s)
+	}
+}
+
+// inputTextSQL reads llm_traces.input_text, rebuilding it from prompt_blobs
+// for rows whose input was stored there.
+const inputTextSQL = `COALESCE(` + textFunc + `(input_text), (
+    SELECT group_concat(` + textFunc + `(b.content), '' ORDER BY j.key)
+    FROM json_each(llm_traces.input_blobs) AS j JOIN prompt_blobs AS b ON b.hash = j.value
+  ))`
+
+// SetPromptStore moves trace inputs of at least minBytes into prompt_blobs,
+// so repeated system prompts and tool schemas are stored once. Rows keep
+// the ordered blob hashes in input_blobs.
+func (m *Manager) SetPromptStore(mode PromptStoreMode, minBytes int) {
+	if minBytes <= 0 {
+		minBytes = DefaultPromptStoreMinBytes
+	}
+	m.promptStore = mode
+	m.promptStoreMinBytes = minBytes
+}
+
+// promptSegments returns the pieces input is stored as, or nil to keep it
+// inline. Concatenating the pieces gives back input byte for byte, unless
+// presplit, the segments of an input cut after splitting, is used.
+func (m *Manager) promptSegments(input string, presplit []string) []string {
+	switch {
+	case m.promptStore != PromptStoreWhole && m.promptStore != PromptStoreSegments:
+		return nil
+	case len(input) < m.promptStoreMinBytes:
+		return nil
+	case m.promptStore == PromptStoreSegments && presplit != nil:
+		return presplit
+	case m.promptStore == PromptStoreSegments:
+		if segments := SplitMessages(input); segments != nil {
+			return segments
+		}
+	}
+	return []string{input}
+}
+
+// SplitMessages cuts a JSON array of chat messages after the leading system
+// messages and before the last message, the parts that change least and most
+// between calls of one conversation. Separators stay with the message that
+// follows them. It returns nil when input is not such an array or there is
+// nothing to cut.
+func SplitMessages(input string) []string {
+	dec := json.NewDecoder(strings.NewReader(input))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil
+	}
+	var ends []int64
+	system := 0
+	for dec.More() {
+		var msg struct {
+			Role string `json:"role"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			return nil
+		}
+		if system == len(ends) && (msg.Role == "system" || msg.Role == "developer") {
+			system++
+		}
+		ends = append(ends, dec.InputOffset())
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil
+	}
+
+	var cuts []int64
+	if system > 0 && system < len(ends) {
+		cuts = append(cuts, ends[system-1])
+	}
+	if len(ends)-system >= 2 {
+		cuts = append(cuts, ends[len(ends)-2])
+	}
+	if len(cuts) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(cuts)+1)
+	from := int64(0)
+	for _, cut := range cuts {
+		out = append(out, input[from:cut])
+		from = cut
+	}
+	return append(out, input[from:])
+}
+
+// hashSegments returns the hex SHA-256 of each segment and the hashes as the
+// JSON array stored in input_blobs.
+func hashSegments(segments []string) ([]string, string) {
+	hashes := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		sum := sha256.Sum256([]byte(segment))
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	encoded, _ := json.Marshal(hashes)
+	return hashes, string(encoded)
+}
+
+// addPromptBlobRef references the blob with hash, inserting segment as its
+// content the first time so a shared prompt is only encoded once.
+func (m *Manager) addPromptBlobRef(ctx context.Context, tx *sql.Tx, hash string, segment string, createdAt int64) error {
+	res, err := tx.ExecContext(ctx, `UPDATE prompt_blobs SET refs = refs + 1 WHERE hash = ?`, hash)
+	if err != nil {
+		return fmt.Errorf("reference prompt blob: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO prompt_blobs (hash, content, bytes, refs, created_at) VALUES (?, ?, ?, 1, ?)
+`, hash, m.storedText(segment), len(segment), createdAt); err != nil {
+		return fmt.Errorf("insert prompt blob: %w", err)
+	}
+	return nil
+}
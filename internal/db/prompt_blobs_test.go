@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitMessagesCutsSystemHistoryAndNewMessage(t *testing.T) {
+	t.Parallel()
+
+	input := `[ {"role":"system","content":"be brief"}, {"role":"user","content":"hi"},{"role":"assistant","content":"hello"} ,{"role":"user","content":"bye"}]`
+	got := SplitMessages(input)
+	if len(got) != 3 || strings.Join(got, "") != input {
+		t.Fatalf("segments = %q", got)
+	}
+	if got[0] != `[ {"role":"system","content":"be brief"}` || got[2] != ` ,{"role":"user","content":"bye"}]` {
+		t.Fatalf("unexpected cuts: %q", got)
+	}
+
+	for _, input := range []string{
+		`[{"role":"user","content":"only"}]`,
+		`[{"role":"system","content":"a"}]`,
+		`{"role":"user"}`,
+		`plain text`,
+		`[{"role":"user"`,
+	} {
+		if got := SplitMessages(input); got != nil {
+			t.Fatalf("SplitMessages(%s) = %q, want nil", input, got)
+		}
+	}
+}
+
+func TestPromptStoreDeduplicatesAndReleasesBlobs(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+	dbm.SetPromptStore(PromptStoreSegments, 64)
+
+	ctx := context.Background()
+	system := `{"role":"system","content":"` + strings.Repeat("You are a careful agent. ", 20) + `"}`
+	old := time.Now().Add(-48 * time.Hour).UnixMilli()
+	var inputs []string
+	var traces []TraceInsert
+	for i := range 3 {
+		input := fmt.Sprintf(`[%s,{"role":"user","content":"turn %d"},{"role":"user","content":"question %d"}]`, system, i, i)
+		inputs = append(inputs, input)
+		traces = append(traces, TraceInsert{
+			TraceID:   fmt.Sprintf("7777777%d-7777-4777-8777-777777777777", i),
+			CreatedAt: old + int64(i),
+			Provider:  "openai",
+			Model:     "gpt-4o",
+			Status:    "ok",
+			InputText: input,
+		})
+	}
+	// A short input stays inline.
+	traces = append(traces, TraceInsert{TraceID: "88888888-8888-4888-8888-888888888888", CreatedAt: time.Now().UnixMilli(), Provider: "openai", Model: "gpt-4o", Status: "ok", InputText: "short"})
+	if _, err := dbm.InsertBatch(ctx, Batch{Traces: traces}); err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+	// Retrying the batch must not add references.
+	if res, err := dbm.InsertBatch(ctx, Batch{Traces: traces[:1]}); err != nil || res.Duplicates != 1 {
+		t.Fatalf("retry = %+v, %v", res, err)
+	}
+
+	blobs := func() (count, refs int64) {
+		t.Helper()
+		if err := dbm.reader.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(refs), 0) FROM prompt_blobs`).Scan(&count, &refs); err != nil {
+			t.Fatalf("count blobs: %v", err)
+		}
+		return count, refs
+	}
+	// One shared system prompt plus a history and a new message per trace.
+	if count, refs := blobs(); count != 7 || refs != 9 {
+		t.Fatalf("blobs = %d with %d refs, want 7 with 9", count, refs)
+	}
+
+	events, err := dbm.FetchUnsyncedEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("fetch unsynced: %v", err)
+	}
+	for i, ev := range events {
+		var payload map[string]any
+		if err := json.Unmarshal(ev.Data, &payload); err != nil {
+			t.Fatalf("decode payload: %v", err)
+		}
+		want := "short"
+		if i < len(inputs) {
+			want = inputs[i]
+		}
+		if payload["input_text"] != want {
+			t.Fatalf("event %d input_text = %v, want %s", i, payload["input_text"], want)
+		}
+	}
+	if _, input, _, err := dbm.LatestTraceTexts(ctx); err != nil || input != "short" {
+		t.Fatalf("latest input = %q, %v", input, err)
+	}
+
+	if _, err := dbm.writer.ExecContext(ctx, `UPDATE llm_traces SET synced = 1`); err != nil {
+		t.Fatalf("mark synced: %v", err)
+	}
+	if _, err := dbm.writer.ExecContext(ctx, `DELETE FROM llm_traces WHERE trace_id = ?`, traces[0].TraceID); err != nil {
+		t.Fatalf("delete trace: %v", err)
+	}
+	if count, refs := blobs(); count != 5 || refs != 6 {
+		t.Fatalf("after one delete blobs = %d with %d refs, want 5 with 6", count, refs)
+	}
+	if _, _, err := dbm.CleanupOldSynced(ctx, 1, 0, 0); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if count, refs := blobs(); count != 0 || refs != 0 {
+		t.Fatalf("after cleanup blobs = %d with %d refs, want none", count, refs)
+	}
+}
@@ -18,6 +18,9 @@ type PushEvent struct {
 	Data      json.RawMessage
 }
 
+// FetchUnsyncedEvents returns pending rows as push events. Metadata is
+// emitted as nested JSON; rows stored before metadata was validated may hold
+// plain text, which is passed through as a string.
 func (m *Manager) FetchUnsyncedEvents(ctx context.Context, limit int) ([]PushEvent, error) {
 	query := `
 SELECT table_name, id, created_at, trace_id, event_type, payload
@@ -28,8 +31,8 @@ FROM (
       'created_at', created_at,
       'provider', provider,
       'model', model,
-      'input_text', input_text,
-      'output_text', output_text,
+      'input_text', ` + inputTextSQL + `,
+      'output_text', ` + textFunc + `(output_text),
       'prompt_tokens', prompt_tokens,
       'completion_tokens', completion_tokens,
       'total_tokens', total_tokens,
@@ -37,7 +40,22 @@ FROM (
       'latency_ms', latency_ms,
       'status', status,
       'error_type', error_type,
-      'metadata', metadata
+      'metadata', CASE WHEN json_valid(metadata) THEN json(metadata) ELSE NULLIF(metadata, '') END,
+      'session_id', session_id,
+      'run_id', run_id,
+      'span_id', span_id,
+      'parent_span_id', parent_span_id,
+      'started_at', started_at,
+      'ended_at', ended_at,
+      'ttft_ms', ttft_ms,
+      'tokens_per_sec', tokens_per_sec,
+      'input_truncated', json(CASE WHEN input_truncated THEN 'true' ELSE 'false' END),
+      'output_truncated', json(CASE WHEN output_truncated THEN 'true' ELSE 'false' END),
+      'input_bytes', input_bytes,
+      'output_bytes', output_bytes,
+      'input_sha256', input_sha256,
+      'output_sha256', output_sha256,
+      'text_dropped', json(CASE WHEN text_dropped THEN 'true' ELSE 'false' END)
     ) AS payload
   FROM llm_traces WHERE synced = 0
   UNION ALL
@@ -45,11 +63,12 @@ FROM (
     json_object(
       'trace_id', trace_id,
       'created_at', created_at,
+      'llm_trace_id', llm_trace_id,
       'error_type', error_type,
       'message', message,
-      'stack_trace', stack_trace,
+      'stack_trace', ` + textFunc + `(stack_trace),
       'severity', severity,
-      'metadata', metadata
+      'metadata', CASE WHEN json_valid(metadata) THEN json(metadata) ELSE NULLIF(metadata, '') END
     ) AS payload
   FROM error_events WHERE synced = 0
   UNION ALL
@@ -64,9 +83,55 @@ FROM (
       'disk_used_bytes', disk_used_bytes,
       'disk_total_bytes', disk_total_bytes,
       'disk_free_bytes', disk_free_bytes,
-      'metadata', metadata
+      'metadata', CASE WHEN json_valid(metadata) THEN json(metadata) ELSE NULLIF(metadata, '') END
     ) AS payload
   FROM system_metrics WHERE synced = 0
+  UNION ALL
+  SELECT 'custom_events' AS table_name, id, created_at, trace_id, 'custom_event' AS event_type,
+    json_object(
+      'trace_id', trace_id,
+      'created_at', created_at,
+      'name', name,
+      'attributes', json(attributes),
+      'metadata', CASE WHEN json_valid(metadata) THEN json(metadata) ELSE NULLIF(metadata, '') END
+    ) AS payload
+  FROM custom_events WHERE synced = 0
+  UNION ALL
+  SELECT 'tool_calls' AS table_name, id, created_at, trace_id, 'tool_call' AS event_type,
+    json_object(
+      'trace_id', trace_id,
+      'created_at', created_at,
+      'llm_trace_id', llm_trace_id,
+      'tool_name', tool_name,
+      'arguments', arguments,
+      'result_bytes', result_bytes,
+      'duration_ms', duration_ms,
+      'status', status,
+      'error_type', error_type,
+      'error_message', error_message,
+      'metadata', CASE WHEN json_valid(metadata) THEN json(metadata) ELSE NULLIF(metadata, '') END,
+      'session_id', session_id,
+      'run_id', run_id,
+      'span_id', span_id,
+      'parent_span_id', parent_span_id,
+      'started_at', started_at,
+      'ended_at', ended_at
+    ) AS payload
+  FROM tool_calls WHERE synced = 0
+  UNION ALL
+  SELECT 'sampled_out' AS table_name, id, created_at, trace_id, 'sampled_out' AS event_type,
+    json_object(
+      'trace_id', trace_id,
+      'created_at', created_at,
+      'provider', provider,
+      'model', model,
+      'traces', traces,
+      'prompt_tokens', prompt_tokens,
+      'completion_tokens', completion_tokens,
+      'total_tokens', total_tokens,
+      'cost_usd', cost_usd
+    ) AS payload
+  FROM sampled_out WHERE synced = 0
 )
 ORDER BY created_at ASC
 LIMIT ?;
@@ -95,6 +160,9 @@ func (m *Manager) MarkEventsSynced(ctx context.Context, events []PushEvent, push
 		"llm_traces":     {},
 		"error_events":   {},
 		"system_metrics": {},
+		"custom_events":  {},
+		"tool_calls":     {},
+		"sampled_out":    {},
 	}
 	for _, ev := range events {
 		grouped[ev.TableName] = append(grouped[ev.TableName], ev.RowID)
@@ -130,15 +198,33 @@ func (m *Manager) MarkEventsSynced(ctx context.Context, events []PushEvent, push
 	return tx.Commit()
 }
 
-func (m *Manager) PendingCounts(ctx context.Context) (traces int64, errs int64, metrics int64, err error) {
-	if err = m.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM llm_traces WHERE synced = 0").Scan(&traces); err != nil {
-		return
-	}
-	if err = m.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM error_events WHERE synced = 0").Scan(&errs); err != nil {
-		return
+// Pending holds the number of unsynced rows per table.
+type Pending struct {
+	Traces       int64
+	Errors       int64
+	Metrics      int64
+	CustomEvents int64
+	ToolCalls    int64
+	SampledOut   int64
+}
+
+func (m *Manager) PendingCounts(ctx context.Context) (Pending, error) {
+	var p Pending
+	counts := []struct {
+		table string
+		dst   *int64
+	}{
+		{"llm_traces", &p.Traces},
+		{"error_events", &p.Errors},
+		{"system_metrics", &p.Metrics},
+		{"custom_events", &p.CustomEvents},
+		{"tool_calls", &p.ToolCalls},
+		{"sampled_out", &p.SampledOut},
 	}
-	if err = m.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM system_metrics WHERE synced = 0").Scan(&metrics); err != nil {
-		return
+	for _, c := range counts {
+		if err := m.reader.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+c.table+" WHERE synced = 0").Scan(c.dst); err != nil {
+			return p, err
+		}
 	}
-	return
+	return p, nil
 }
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"path/filepath"
 	"testing"
 )
@@ -16,23 +17,28 @@ func TestLatestRowQueries(t *testing.T) {
 	}
 	defer func() { _ = dbm.Close() }()
 
-	err = dbm.InsertBatch(context.Background(),
-		[]TraceInsert{{
+	_, err = dbm.InsertBatch(context.Background(), Batch{
+		Traces: []TraceInsert{{
 			TraceID:   "11111111-1111-4111-8111-111111111111",
 			CreatedAt: 1,
 			Provider:  "anthropic",
 			Model:     "claude-sonnet-4",
 			Status:    "ok",
 		}},
-		[]ErrorInsert{{
+		Errors: []ErrorInsert{{
 			TraceID:   "22222222-2222-4222-8222-222222222222",
 			CreatedAt: 2,
 			ErrorType: "llm_error",
 			Message:   "rate limited",
 			Severity:  "error",
 		}},
-		nil,
-	)
+		CustomEvents: []CustomEventInsert{{
+			TraceID:    "33333333-3333-4333-8333-333333333333",
+			CreatedAt:  3,
+			Name:       "memory_compacted",
+			Attributes: `{"freed_bytes":1024}`,
+		}},
+	})
 	if err != nil {
 		t.Fatalf("insert batch: %v", err)
 	}
@@ -52,4 +58,241 @@ func TestLatestRowQueries(t *testing.T) {
 	if errorRow.ErrorType != "llm_error" || errorRow.Message != "rate limited" {
 		t.Fatalf("unexpected error row: %+v", errorRow)
 	}
+
+	eventRow, err := dbm.LatestCustomEvent(context.Background())
+	if err != nil {
+		t.Fatalf("latest custom event: %v", err)
+	}
+	if eventRow.Name != "memory_compacted" || eventRow.Attributes != `{"freed_bytes":1024}` {
+		t.Fatalf("unexpected custom event row: %+v", eventRow)
+	}
+}
+
+func TestFetchUnsyncedEventsIncludesTraceHierarchy(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	_, err = dbm.InsertBatch(context.Background(), Batch{
+		Traces: []TraceInsert{
+			{
+				TraceID:   "44444444-4444-4444-8444-444444444444",
+				CreatedAt: 1,
+				Provider:  "anthropic",
+				Model:     "claude-sonnet-4",
+				Status:    "ok",
+				SessionID: "chat-1",
+				RunID:     "run-1",
+				SpanID:    "span-root",
+			},
+			{
+				TraceID:      "55555555-5555-4555-8555-555555555555",
+				CreatedAt:    2,
+				Provider:     "anthropic",
+				Model:        "claude-sonnet-4",
+				Status:       "ok",
+				SessionID:    "chat-1",
+				RunID:        "run-1",
+				SpanID:       "span-child",
+				ParentSpanID: "span-root",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+
+	events, err := dbm.FetchUnsyncedEvents(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("fetch unsynced: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want 2", len(events))
+	}
+
+	var root, child map[string]any
+	if err := json.Unmarshal(events[0].Data, &root); err != nil {
+		t.Fatalf("decode root payload: %v", err)
+	}
+	if err := json.Unmarshal(events[1].Data, &child); err != nil {
+		t.Fatalf("decode child payload: %v", err)
+	}
+	if root["session_id"] != "chat-1" || root["run_id"] != "run-1" || root["parent_span_id"] != nil {
+		t.Fatalf("unexpected root payload: %v", root)
+	}
+	if child["span_id"] != "span-child" || child["parent_span_id"] != "span-root" {
+		t.Fatalf("unexpected child payload: %v", child)
+	}
+}
+
+func TestFetchUnsyncedEventsNestsMetadata(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ctx := context.Background()
+	_, err = dbm.InsertBatch(ctx, Batch{
+		Traces: []TraceInsert{{
+			TraceID:   "66666666-6666-4666-8666-666666666666",
+			CreatedAt: 1,
+			Provider:  "anthropic",
+			Model:     "claude-sonnet-4",
+			Status:    "ok",
+			Metadata:  `{"user":"u1","tags":["a"]}`,
+		}},
+		Errors: []ErrorInsert{{
+			TraceID:   "77777777-7777-4777-8777-777777777777",
+			CreatedAt: 2,
+			ErrorType: "crash",
+			Message:   "boom",
+			Severity:  "error",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+	// Rows written before metadata was validated can hold plain text.
+	if _, err := dbm.writer.ExecContext(ctx, `
+INSERT INTO system_metrics (trace_id, created_at, cpu_pct, mem_rss_bytes, mem_available, mem_total,
+  disk_used_bytes, disk_total_bytes, disk_free_bytes, metadata, synced)
+VALUES ('legacy-metric', 3, 0, 0, 0, 0, 0, 0, 0, 'host=a', 0)`); err != nil {
+		t.Fatalf("insert legacy row: %v", err)
+	}
+
+	var user string
+	if err := dbm.reader.QueryRowContext(ctx, `SELECT json_extract(metadata, '$.user') FROM llm_traces`).Scan(&user); err != nil || user != "u1" {
+		t.Fatalf("json_extract user = %q, %v", user, err)
+	}
+
+	events, err := dbm.FetchUnsyncedEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("fetch unsynced: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %d, want 3", len(events))
+	}
+	payloads := make([]map[string]any, len(events))
+	for i, ev := range events {
+		if err := json.Unmarshal(ev.Data, &payloads[i]); err != nil {
+			t.Fatalf("decode payload %d: %v", i, err)
+		}
+	}
+	meta, ok := payloads[0]["metadata"].(map[string]any)
+	if !ok || meta["user"] != "u1" {
+		t.Fatalf("trace metadata = %#v, want nested object", payloads[0]["metadata"])
+	}
+	if payloads[1]["metadata"] != nil {
+		t.Fatalf("error metadata = %#v, want null", payloads[1]["metadata"])
+	}
+	if payloads[2]["metadata"] != "host=a" {
+		t.Fatalf("legacy metadata = %#v, want plain string", payloads[2]["metadata"])
+	}
+}
+
+func TestFetchUnsyncedEventsIncludesToolCalls(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	_, err = dbm.InsertBatch(context.Background(), Batch{
+		ToolCalls: []ToolCallInsert{{
+			TraceID:     "88888888-8888-4888-8888-888888888888",
+			CreatedAt:   1,
+			LLMTraceID:  "44444444-4444-4444-8444-444444444444",
+			ToolName:    "web_fetch",
+			Arguments:   `{"url":"https://example.com"}`,
+			ResultBytes: 512,
+			DurationMS:  80,
+			Status:      "ok",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+
+	events, err := dbm.FetchUnsyncedEvents(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("fetch unsynced: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != "tool_call" || events[0].TableName != "tool_calls" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(events[0].Data, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload["tool_name"] != "web_fetch" || payload["llm_trace_id"] != "44444444-4444-4444-8444-444444444444" {
+		t.Fatalf("unexpected payload: %v", payload)
+	}
+	if payload["result_bytes"] != float64(512) || payload["error_type"] != nil {
+		t.Fatalf("unexpected payload outcome: %v", payload)
+	}
+
+	if err := dbm.MarkEventsSynced(context.Background(), events, 2); err != nil {
+		t.Fatalf("mark synced: %v", err)
+	}
+	pending, err := dbm.PendingCounts(context.Background())
+	if err != nil || pending.ToolCalls != 0 {
+		t.Fatalf("pending tool calls = %d, %v", pending.ToolCalls, err)
+	}
+}
+
+func TestFetchUnsyncedEventsReportsTruncation(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	_, err = dbm.InsertBatch(context.Background(), Batch{
+		Traces: []TraceInsert{{
+			TraceID:        "66666666-6666-4666-8666-666666666666",
+			CreatedAt:      1,
+			Provider:       "openai",
+			Model:          "gpt-4o",
+			Status:         "ok",
+			InputText:      "abc",
+			OutputText:     "done",
+			InputTruncated: true,
+			InputBytes:     300,
+			OutputBytes:    4,
+			InputSHA256:    "in-hash",
+			OutputSHA256:   "out-hash",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("insert batch: %v", err)
+	}
+
+	events, err := dbm.FetchUnsyncedEvents(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("fetch unsynced: %v", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(events[0].Data, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload["input_truncated"] != true || payload["output_truncated"] != false {
+		t.Fatalf("truncation flags = %v, %v", payload["input_truncated"], payload["output_truncated"])
+	}
+	if payload["input_bytes"] != float64(300) || payload["input_sha256"] != "in-hash" || payload["output_sha256"] != "out-hash" {
+		t.Fatalf("unexpected payload: %v", payload)
+	}
 }
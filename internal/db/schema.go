@@ -1,5 +1,10 @@
 package db
 
+import (
+	"database/sql"
+	"fmt"
+)
+
 const schemaDDL = `
 CREATE TABLE IF NOT EXISTS llm_traces (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -17,6 +22,22 @@ CREATE TABLE IF NOT EXISTS llm_traces (
   status TEXT NOT NULL DEFAULT 'ok',
   error_type TEXT,
   metadata TEXT,
+  session_id TEXT,
+  run_id TEXT,
+  span_id TEXT,
+  parent_span_id TEXT,
+  started_at INTEGER,
+  ended_at INTEGER,
+  ttft_ms INTEGER,
+  tokens_per_sec REAL,
+  input_truncated INTEGER NOT NULL DEFAULT 0,
+  output_truncated INTEGER NOT NULL DEFAULT 0,
+  input_bytes INTEGER,
+  output_bytes INTEGER,
+  input_sha256 TEXT,
+  output_sha256 TEXT,
+  input_blobs TEXT,
+  text_dropped INTEGER NOT NULL DEFAULT 0,
   synced INTEGER NOT NULL DEFAULT 0,
   pushed_at INTEGER
 );
@@ -25,6 +46,7 @@ CREATE TABLE IF NOT EXISTS error_events (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   trace_id TEXT NOT NULL UNIQUE,
   created_at INTEGER NOT NULL,
+  llm_trace_id TEXT,
   error_type TEXT NOT NULL,
   message TEXT NOT NULL,
   stack_trace TEXT,
@@ -50,6 +72,40 @@ CREATE TABLE IF NOT EXISTS system_metrics (
   pushed_at INTEGER
 );
 
+CREATE TABLE IF NOT EXISTS custom_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  trace_id TEXT NOT NULL UNIQUE,
+  created_at INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  attributes TEXT NOT NULL DEFAULT '{}' CHECK (json_valid(attributes)),
+  metadata TEXT,
+  synced INTEGER NOT NULL DEFAULT 0,
+  pushed_at INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS tool_calls (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  trace_id TEXT NOT NULL UNIQUE,
+  created_at INTEGER NOT NULL,
+  llm_trace_id TEXT,
+  tool_name TEXT NOT NULL,
+  arguments TEXT,
+  result_bytes INTEGER,
+  duration_ms INTEGER,
+  status TEXT NOT NULL DEFAULT 'ok',
+  error_type TEXT,
+  error_message TEXT,
+  metadata TEXT,
+  session_id TEXT,
+  run_id TEXT,
+  span_id TEXT,
+  parent_span_id TEXT,
+  started_at INTEGER,
+  ended_at INTEGER,
+  synced INTEGER NOT NULL DEFAULT 0,
+  pushed_at INTEGER
+);
+
 CREATE TABLE IF NOT EXISTS push_log (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   created_at INTEGER NOT NULL,
@@ -59,7 +115,128 @@ CREATE TABLE IF NOT EXISTS push_log (
   duration_ms INTEGER
 );
 
+CREATE TABLE IF NOT EXISTS prompt_blobs (
+  hash TEXT PRIMARY KEY,
+  content TEXT NOT NULL,
+  bytes INTEGER NOT NULL,
+  refs INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sampled_out (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  trace_id TEXT NOT NULL UNIQUE,
+  created_at INTEGER NOT NULL,
+  provider TEXT NOT NULL,
+  model TEXT NOT NULL,
+  traces INTEGER NOT NULL,
+  prompt_tokens INTEGER NOT NULL DEFAULT 0,
+  completion_tokens INTEGER NOT NULL DEFAULT 0,
+  total_tokens INTEGER NOT NULL DEFAULT 0,
+  cost_usd REAL NOT NULL DEFAULT 0,
+  synced INTEGER NOT NULL DEFAULT 0,
+  pushed_at INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS dead_letter (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at INTEGER NOT NULL,
+  kind TEXT NOT NULL,
+  trace_id TEXT UNIQUE,
+  payload TEXT NOT NULL,
+  error TEXT NOT NULL
+);
+
 CREATE INDEX IF NOT EXISTS idx_llm_synced ON llm_traces (synced, created_at);
 CREATE INDEX IF NOT EXISTS idx_error_synced ON error_events (synced, created_at);
 CREATE INDEX IF NOT EXISTS idx_metrics_synced ON system_metrics (synced, created_at);
+CREATE INDEX IF NOT EXISTS idx_custom_synced ON custom_events (synced, created_at);
+CREATE INDEX IF NOT EXISTS idx_sampled_synced ON sampled_out (synced, created_at);
+CREATE INDEX IF NOT EXISTS idx_dead_letter_created ON dead_letter (created_at);
+CREATE INDEX IF NOT EXISTS idx_custom_name ON custom_events (name, created_at);
+CREATE INDEX IF NOT EXISTS idx_tool_synced ON tool_calls (synced, created_at);
+CREATE INDEX IF NOT EXISTS idx_tool_name ON tool_calls (tool_name, created_at);
+CREATE INDEX IF NOT EXISTS idx_tool_llm_trace ON tool_calls (llm_trace_id) WHERE llm_trace_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_tool_session ON tool_calls (session_id, created_at) WHERE session_id IS NOT NULL;
+`
+
+// columnMigrations lists columns added after their table first shipped.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so databases
+// created by older versions get these columns through ALTER TABLE.
+var columnMigrations = []struct {
+	table  string
+	column string
+	def    string
+}{
+	{"llm_traces", "session_id", "TEXT"},
+	{"llm_traces", "run_id", "TEXT"},
+	{"llm_traces", "span_id", "TEXT"},
+	{"llm_traces", "parent_span_id", "TEXT"},
+	{"llm_traces", "started_at", "INTEGER"},
+	{"llm_traces", "ended_at", "INTEGER"},
+	{"llm_traces", "ttft_ms", "INTEGER"},
+	{"llm_traces", "tokens_per_sec", "REAL"},
+	{"llm_traces", "input_truncated", "INTEGER NOT NULL DEFAULT 0"},
+	{"llm_traces", "output_truncated", "INTEGER NOT NULL DEFAULT 0"},
+	{"llm_traces", "input_bytes", "INTEGER"},
+	{"llm_traces", "output_bytes", "INTEGER"},
+	{"llm_traces", "input_sha256", "TEXT"},
+	{"llm_traces", "output_sha256", "TEXT"},
+	{"llm_traces", "input_blobs", "TEXT"},
+	{"llm_traces", "text_dropped", "INTEGER NOT NULL DEFAULT 0"},
+	{"error_events", "llm_trace_id", "TEXT"},
+}
+
+// indexDDL runs after columnMigrations because it references migrated columns.
+const indexDDL = `
+CREATE INDEX IF NOT EXISTS idx_llm_session ON llm_traces (session_id, created_at) WHERE session_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_llm_run ON llm_traces (run_id, created_at) WHERE run_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_llm_span ON llm_traces (span_id) WHERE span_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_llm_parent_span ON llm_traces (parent_span_id) WHERE parent_span_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_error_llm_trace ON error_events (llm_trace_id) WHERE llm_trace_id IS NOT NULL;
+
+-- Deleting a trace, by cleanup or otherwise, releases its prompt blobs; a
+-- blob goes once no trace refers to it.
+CREATE TRIGGER IF NOT EXISTS trg_llm_release_blobs AFTER DELETE ON llm_traces
+WHEN OLD.input_blobs IS NOT NULL
+BEGIN
+  UPDATE prompt_blobs
+  SET refs = refs - (SELECT COUNT(*) FROM json_each(OLD.input_blobs) WHERE value = prompt_blobs.hash)
+  WHERE hash IN (SELECT value FROM json_each(OLD.input_blobs));
+  DELETE FROM prompt_blobs WHERE refs <= 0 AND hash IN (SELECT value FROM json_each(OLD.input_blobs));
+END;
 `
+
+func migrateColumns(writer *sql.DB) error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(writer, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := writer.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.def)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+func columnExists(writer *sql.DB, table string, column string) (bool, error) {
+	rows, err := writer.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,162 @@
+package ingest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// QueueFullPolicy selects what happens to an event that arrives while the
+// ingest channel, and the spill when there is one, are full.
+type QueueFullPolicy string
+
+const (
+	// PolicyDrop discards the event; HTTP clients still get 202.
+	PolicyDrop QueueFullPolicy = "drop"
+	// PolicyReject discards the event and HTTP clients get 429 with
+	// Retry-After so they can resend.
+	PolicyReject QueueFullPolicy = "reject"
+	// PolicyBlock waits up to the block timeout for room in the queue.
+	PolicyBlock QueueFullPolicy = "block"
+	// PolicyEvict removes the oldest queued event of a lower priority kind
+	// (metrics first) to make room.
+	PolicyEvict QueueFullPolicy = "evict"
+)
+
+const DefaultBlockTimeout = 50 * time.Millisecond
+
+func ParseQueueFullPolicy(s string) (QueueFullPolicy, error) {
+	switch p := QueueFullPolicy(s); p {
+	case PolicyDrop, PolicyReject, PolicyBlock, PolicyEvict:
+		return p, nil
+	case "":
+		return PolicyDrop, nil
+	default:
+		return "", fmt.Errorf("unknown queue full policy %q", s)
+	}
+}
+
+// kindPriority orders event kinds for eviction; lower values are evicted
+// first.
+func kindPriority(kind EventKind) int {
+	switch kind {
+	case EventKindMetric:
+		return 0
+	case EventKindCustom:
+		return 1
+	default:
+		return 2
+	}
+}
+
+type Backpressure struct {
+	policy       QueueFullPolicy
+	blockTimeout time.Duration
+	spill        *Spill
+
+	// Producers hold mu for reading; evict holds it for writing, so no
+	// event can take a slot it frees while it drains and refills the channel.
+	mu sync.RWMutex
+}
+
+func NewBackpressure(policy QueueFullPolicy, blockTimeout time.Duration) *Backpressure {
+	if blockTimeout <= 0 {
+		blockTimeout = DefaultBlockTimeout
+	}
+	return &Backpressure{policy: policy, blockTimeout: blockTimeout}
+}
+
+// SetSpill sends events that do not fit in the channel to disk. The policy
+// applies only once the spill is full too.
+func (b *Backpressure) SetSpill(spill *Spill) {
+	b.spill = spill
+}
+
+func (b *Backpressure) Policy() QueueFullPolicy {
+	return b.policy
+}
+
+// Enqueue offers event to ch according to the policy. It reports whether the
+// event was queued and returns any queued events that were discarded to make
+// room for it.
+func (b *Backpressure) Enqueue(ch chan Event, event Event) (bool, []Event) {
+	b.mu.RLock()
+	ok := b.offer(ch, event)
+	b.mu.RUnlock()
+	if ok || b.policy != PolicyEvict {
+		return ok, nil
+	}
+	return b.evict(ch, event)
+}
+
+func (b *Backpressure) offer(ch chan Event, event Event) bool {
+	// While spilled events wait on disk, newer events queue behind them so
+	// the worker stores everything in arrival order.
+	if b.spill != nil && b.spill.Pending() > 0 && b.spill.Append(event) == nil {
+		return true
+	}
+	if TryEnqueue(ch, event) {
+		return true
+	}
+	if b.spill != nil && b.spill.Append(event) == nil {
+		return true
+	}
+	if b.policy != PolicyBlock {
+		return false
+	}
+	timer := time.NewTimer(b.blockTimeout)
+	defer timer.Stop()
+	select {
+	case ch <- event:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// evict drains the channel, removes the oldest event with a lower priority
+// than event and refills the channel in the original order followed by
+// event. Only the worker can touch the channel meanwhile, and it only frees
+// room, so the refill always fits.
+func (b *Backpressure) evict(ch chan Event, event Event) (bool, []Event) {
+	if kindPriority(event.Kind) == 0 {
+		return false, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if TryEnqueue(ch, event) {
+		return true, nil
+	}
+
+	held := make([]Event, 0, cap(ch))
+drain:
+	for len(held) < cap(ch) {
+		select {
+		case old := <-ch:
+			held = append(held, old)
+		default:
+			break drain
+		}
+	}
+
+	victim := -1
+	for i, old := range held {
+		if kindPriority(old.Kind) >= kindPriority(event.Kind) {
+			continue
+		}
+		if victim < 0 || kindPriority(old.Kind) < kindPriority(held[victim].Kind) {
+			victim = i
+		}
+	}
+
+	var discarded []Event
+	if victim >= 0 {
+		discarded = append(discarded, held[victim])
+		held = append(held[:victim], held[victim+1:]...)
+	}
+	for _, old := range held {
+		ch <- old
+	}
+	return TryEnqueue(ch, event), discarded
+}
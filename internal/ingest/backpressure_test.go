@@ -0,0 +1,158 @@
+package ingest
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseQueueFullPolicy(t *testing.T) {
+	t.Parallel()
+
+	if p, err := ParseQueueFullPolicy(""); err != nil || p != PolicyDrop {
+		t.Fatalf("empty policy = %q, %v; want drop", p, err)
+	}
+	if _, err := ParseQueueFullPolicy("spill-everywhere"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestBackpressureBlockWaitsForRoom(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan Event, 1)
+	ch <- Event{Kind: EventKindTrace}
+	bp := NewBackpressure(PolicyBlock, time.Second)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-ch
+	}()
+
+	ok, evicted := bp.Enqueue(ch, Event{Kind: EventKindError})
+	if !ok || len(evicted) != 0 {
+		t.Fatalf("block enqueue = %v, evicted %d; want accepted after room frees up", ok, len(evicted))
+	}
+}
+
+func TestBackpressureBlockTimesOut(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan Event, 1)
+	ch <- Event{Kind: EventKindTrace}
+	bp := NewBackpressure(PolicyBlock, 10*time.Millisecond)
+
+	if ok, _ := bp.Enqueue(ch, Event{Kind: EventKindTrace}); ok {
+		t.Fatalf("expected block enqueue to give up after timeout")
+	}
+}
+
+func TestBackpressureEvictsOldestMetric(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan Event, 3)
+	ch <- Event{Kind: EventKindTrace, TraceID: "t1"}
+	ch <- Event{Kind: EventKindMetric, TraceID: "m1"}
+	ch <- Event{Kind: EventKindMetric, TraceID: "m2"}
+	bp := NewBackpressure(PolicyEvict, 0)
+
+	ok, evicted := bp.Enqueue(ch, Event{Kind: EventKindError, TraceID: "e1"})
+	if !ok {
+		t.Fatalf("expected error event to be queued by evicting a metric")
+	}
+	if len(evicted) != 1 || evicted[0].TraceID != "m1" {
+		t.Fatalf("evicted = %+v, want oldest metric m1", evicted)
+	}
+
+	var order []string
+	for len(ch) > 0 {
+		order = append(order, (<-ch).TraceID)
+	}
+	want := []string{"t1", "m2", "e1"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("queue order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestBackpressureEvictNeverDisplacesHigherPriority(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan Event, 1)
+	ch <- Event{Kind: EventKindTrace, TraceID: "t1"}
+	bp := NewBackpressure(PolicyEvict, 0)
+
+	if ok, evicted := bp.Enqueue(ch, Event{Kind: EventKindMetric}); ok || len(evicted) != 0 {
+		t.Fatalf("metric must not evict a trace: ok=%v evicted=%d", ok, len(evicted))
+	}
+	if ok, evicted := bp.Enqueue(ch, Event{Kind: EventKindError}); ok || len(evicted) != 0 {
+		t.Fatalf("error must not evict a trace: ok=%v evicted=%d", ok, len(evicted))
+	}
+	if got := (<-ch).TraceID; got != "t1" {
+		t.Fatalf("queued trace = %q, want t1 kept", got)
+	}
+}
+
+func TestBackpressureEvictUnderConcurrentProducers(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan Event, 64)
+	bp := NewBackpressure(PolicyEvict, 0)
+
+	// The consumer frees slots while evictions drain and refill the channel.
+	var stop atomic.Bool
+	consumed := make(chan int)
+	go func() {
+		n := 0
+		for !stop.Load() {
+			select {
+			case ev := <-ch:
+				if ev.Kind == EventKindError {
+					n++
+				}
+			default:
+			}
+		}
+		for len(ch) > 0 {
+			if (<-ch).Kind == EventKindError {
+				n++
+			}
+		}
+		consumed <- n
+	}()
+
+	var wg sync.WaitGroup
+	var accepted, lost atomic.Int64
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			kind := EventKindError
+			if i%2 == 0 {
+				kind = EventKindMetric
+			}
+			for range 5000 {
+				ok, evicted := bp.Enqueue(ch, Event{Kind: kind})
+				if ok && kind == EventKindError {
+					accepted.Add(1)
+				}
+				for _, ev := range evicted {
+					if ev.Kind != EventKindMetric {
+						lost.Add(1)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	stop.Store(true)
+
+	if n := lost.Load(); n > 0 {
+		t.Fatalf("%d error events were evicted, want only metrics", n)
+	}
+	if got := <-consumed; int64(got) != accepted.Load() {
+		t.Fatalf("consumed %d error events, want all %d accepted ones", got, accepted.Load())
+	}
+}
@@ -0,0 +1,104 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	MaxMetadataBytes = 16 << 10
+	MaxMetadataDepth = 8
+)
+
+// NormalizeMetadata validates client metadata and returns it as compact JSON
+// text suitable for json_extract. A JSON object is the preferred form. For
+// backward compatibility a JSON string is also accepted: if it contains an
+// encoded object (the old double-encoded convention) that object is used,
+// otherwise the string is kept as a JSON string value.
+func NormalizeMetadata(raw json.RawMessage) (string, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return "", nil
+	}
+
+	if trimmed[0] == '"' {
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return "", errors.New("metadata must be a json object")
+		}
+		inner := bytes.TrimSpace([]byte(s))
+		if len(inner) == 0 {
+			return "", nil
+		}
+		if inner[0] != '{' || !json.Valid(inner) {
+			if len(trimmed) > MaxMetadataBytes {
+				return "", fmt.Errorf("metadata exceeds %d bytes", MaxMetadataBytes)
+			}
+			return string(trimmed), nil
+		}
+		trimmed = inner
+	}
+
+	if trimmed[0] != '{' {
+		return "", errors.New("metadata must be a json object")
+	}
+	if len(trimmed) > MaxMetadataBytes {
+		return "", fmt.Errorf("metadata exceeds %d bytes", MaxMetadataBytes)
+	}
+	if err := checkDepth(trimmed, MaxMetadataDepth); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, trimmed); err != nil {
+		return "", errors.New("metadata must be a json object")
+	}
+	return buf.String(), nil
+}
+
+func checkDepth(raw []byte, maxDepth int) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("metadata must be a json object")
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			continue
+		}
+		switch delim {
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("metadata exceeds nesting depth %d", maxDepth)
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+}
+
+// MergeMetadata adds fields to the metadata of whichever payload the event
+// carries.
+func (e *Event) MergeMetadata(fields map[string]any) {
+	switch {
+	case e.Trace != nil:
+		e.Trace.Metadata = MergeMetadata(e.Trace.Metadata, fields)
+	case e.Error != nil:
+		e.Error.Metadata = MergeMetadata(e.Error.Metadata, fields)
+	case e.Metric != nil:
+		e.Metric.Metadata = MergeMetadata(e.Metric.Metadata, fields)
+	case e.Custom != nil:
+		e.Custom.Metadata = MergeMetadata(e.Custom.Metadata, fields)
+	case e.ToolCall != nil:
+		e.ToolCall.Metadata = MergeMetadata(e.ToolCall.Metadata, fields)
+	}
+}
@@ -0,0 +1,59 @@
+package ingest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMetadata(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"absent", ``, ""},
+		{"null", `null`, ""},
+		{"object", `{ "user": "u1", "tags": ["a", "b"] }`, `{"user":"u1","tags":["a","b"]}`},
+		{"encoded object", `"{\"req\":\"1\"}"`, `{"req":"1"}`},
+		{"plain string", `"nightly run"`, `"nightly run"`},
+		{"empty string", `""`, ""},
+	}
+	for _, tc := range cases {
+		got, err := NormalizeMetadata(json.RawMessage(tc.in))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeMetadataRejectsInvalid(t *testing.T) {
+	t.Parallel()
+
+	deep := strings.Repeat(`{"a":`, MaxMetadataDepth+1) + "1" + strings.Repeat("}", MaxMetadataDepth+1)
+	large := `{"blob":"` + strings.Repeat("x", MaxMetadataBytes) + `"}`
+	cases := map[string]string{
+		"array":          `[1,2]`,
+		"number":         `42`,
+		"too deep":       deep,
+		"too large":      large,
+		"encoded deep":   jsonQuote(deep),
+		"encoded large":  jsonQuote(large),
+		"plain too long": `"` + strings.Repeat("x", MaxMetadataBytes) + `"`,
+	}
+	for name, in := range cases {
+		if _, err := NormalizeMetadata(json.RawMessage(in)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func jsonQuote(s string) string {
+	raw, _ := json.Marshal(s)
+	return string(raw)
+}
@@ -0,0 +1,173 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Processor transforms an event before it is queued for persistence. It may
+// enrich or rewrite the event in place; returning false drops it.
+type Processor interface {
+	Process(event *Event) bool
+}
+
+// ProcessorFunc adapts a function to Processor.
+type ProcessorFunc func(event *Event) bool
+
+func (f ProcessorFunc) Process(event *Event) bool {
+	return f(event)
+}
+
+// Chain runs processors in order and stops at the first that drops the
+// event. The empty chain keeps everything.
+type Chain []Processor
+
+func (c Chain) Process(event *Event) bool {
+	for _, p := range c {
+		if !p.Process(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabels parses a comma-separated list of key=value pairs.
+func ParseLabels(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("entry %q must have the form key=value", item)
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+// HostLabels adds labels to the metadata of every event. Keys the event
+// already carries are left alone.
+func HostLabels(labels map[string]string) Processor {
+	fields := make(map[string]any, len(labels))
+	for k, v := range labels {
+		fields[k] = v
+	}
+	return ProcessorFunc(func(event *Event) bool {
+		if meta := metadataOf(event); meta != nil {
+			*meta = fillMetadata(*meta, fields)
+		}
+		return true
+	})
+}
+
+// DefaultFields lists the keys accepted by FieldDefaults.
+var DefaultFields = []string{
+	"trace.provider", "trace.model", "trace.status", "trace.session_id",
+	"error.error_type", "error.severity",
+	"tool_call.status", "tool_call.session_id",
+}
+
+// FieldDefaults fills empty fields with defaults keyed by kind and field,
+// such as "trace.provider" or "error.severity"; see DefaultFields.
+func FieldDefaults(defaults map[string]string) (Processor, error) {
+	for key := range defaults {
+		if !slices.Contains(DefaultFields, key) {
+			return nil, fmt.Errorf("unknown default field %q", key)
+		}
+	}
+	return ProcessorFunc(func(event *Event) bool {
+		for key, value := range defaults {
+			if p := defaultField(event, key); p != nil && *p == "" {
+				*p = value
+			}
+		}
+		return true
+	}), nil
+}
+
+func defaultField(event *Event, key string) *string {
+	switch t, e, c := event.Trace, event.Error, event.ToolCall; {
+	case t != nil && key == "trace.provider":
+		return &t.Provider
+	case t != nil && key == "trace.model":
+		return &t.Model
+	case t != nil && key == "trace.status":
+		return &t.Status
+	case t != nil && key == "trace.session_id":
+		return &t.SessionID
+	case e != nil && key == "error.error_type":
+		return &e.ErrorType
+	case e != nil && key == "error.severity":
+		return &e.Severity
+	case c != nil && key == "tool_call.status":
+		return &c.Status
+	case c != nil && key == "tool_call.session_id":
+		return &c.SessionID
+	default:
+		return nil
+	}
+}
+
+// Normalize trims identifiers and lowercases providers, statuses and
+// severities, so that "OpenAI " and "openai" are stored alike. Model names
+// are only trimmed since some deployments name them case-sensitively.
+func Normalize() Processor {
+	return ProcessorFunc(func(event *Event) bool {
+		switch {
+		case event.Trace != nil:
+			t := event.Trace
+			t.Provider = strings.ToLower(strings.TrimSpace(t.Provider))
+			t.Model = strings.TrimSpace(t.Model)
+			t.Status = strings.ToLower(strings.TrimSpace(t.Status))
+		case event.Error != nil:
+			e := event.Error
+			e.ErrorType = strings.TrimSpace(e.ErrorType)
+			e.Severity = strings.ToLower(strings.TrimSpace(e.Severity))
+		case event.ToolCall != nil:
+			c := event.ToolCall
+			c.ToolName = strings.TrimSpace(c.ToolName)
+			c.Status = strings.ToLower(strings.TrimSpace(c.Status))
+		case event.Custom != nil:
+			event.Custom.Name = strings.TrimSpace(event.Custom.Name)
+		}
+		return true
+	})
+}
+
+func metadataOf(event *Event) *string {
+	switch {
+	case event.Trace != nil:
+		return &event.Trace.Metadata
+	case event.Error != nil:
+		return &event.Error.Metadata
+	case event.Metric != nil:
+		return &event.Metric.Metadata
+	case event.Custom != nil:
+		return &event.Custom.Metadata
+	case event.ToolCall != nil:
+		return &event.ToolCall.Metadata
+	default:
+		return nil
+	}
+}
+
+// fillMetadata merges the fields meta does not already hold.
+func fillMetadata(meta string, fields map[string]any) string {
+	existing := map[string]any{}
+	if meta != "" {
+		_ = json.Unmarshal([]byte(meta), &existing)
+	}
+	missing := make(map[string]any, len(fields))
+	for k, v := range fields {
+		if _, ok := existing[k]; !ok {
+			missing[k] = v
+		}
+	}
+	return MergeMetadata(meta, missing)
+}
@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/kon-rad/openclaw-trace/internal/db"
+)
+
+func TestChainRunsInOrderAndStopsOnDrop(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+	record := func(name string, keep bool) Processor {
+		return ProcessorFunc(func(event *Event) bool {
+			calls = append(calls, name)
+			return keep
+		})
+	}
+
+	if !(Chain{}).Process(&Event{Kind: EventKindMetric, Metric: &MetricPayload{}}) {
+		t.Fatalf("empty chain dropped the event")
+	}
+	chain := Chain{record("a", true), record("b", false), record("c", true)}
+	if chain.Process(&Event{Kind: EventKindMetric, Metric: &MetricPayload{}}) {
+		t.Fatalf("chain kept an event a processor dropped")
+	}
+	if len(calls) != 2 || calls[0] != "a" || calls[1] != "b" {
+		t.Fatalf("calls = %v, want a then b", calls)
+	}
+}
+
+func TestBuiltinProcessors(t *testing.T) {
+	t.Parallel()
+
+	labels, err := ParseLabels("host=box-1, env=prod")
+	if err != nil {
+		t.Fatalf("parse labels: %v", err)
+	}
+	defaults, err := FieldDefaults(map[string]string{"trace.model": "unknown", "error.severity": "warning"})
+	if err != nil {
+		t.Fatalf("field defaults: %v", err)
+	}
+	chain := Chain{Normalize(), defaults, HostLabels(labels)}
+
+	trace := Event{Kind: EventKindTrace, Trace: &TracePayload{Provider: " OpenAI", Status: "OK", Metadata: `{"env":"dev"}`}}
+	chain.Process(&trace)
+	if trace.Trace.Provider != "openai" || trace.Trace.Status != "ok" || trace.Trace.Model != "unknown" {
+		t.Fatalf("trace = %+v", trace.Trace)
+	}
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(trace.Trace.Metadata), &meta); err != nil || meta["env"] != "dev" || meta["host"] != "box-1" {
+		t.Fatalf("metadata = %s (%v), want env kept and host added", trace.Trace.Metadata, err)
+	}
+
+	errEv := Event{Kind: EventKindError, Error: &ErrorPayload{ErrorType: "timeout", Message: "slow"}}
+	chain.Process(&errEv)
+	if errEv.Error.Severity != "warning" || errEv.Error.Metadata != `{"env":"prod","host":"box-1"}` {
+		t.Fatalf("error = %+v", errEv.Error)
+	}
+
+	if _, err := FieldDefaults(map[string]string{"trace.cost": "0"}); err == nil {
+		t.Fatalf("expected an unknown default field to be rejected")
+	}
+	if _, err := ParseLabels("no-value"); err == nil {
+		t.Fatalf("expected a label without = to be rejected")
+	}
+}
+
+func TestChainBeforeWorker(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	dropHealthChecks := ProcessorFunc(func(event *Event) bool {
+		return event.Custom == nil || event.Custom.Name != "health_check"
+	})
+	chain := Chain{Normalize(), dropHealthChecks}
+
+	ch := make(chan Event, QueueCapacity)
+	for _, ev := range []Event{
+		{Kind: EventKindTrace, Trace: &TracePayload{Provider: "Anthropic ", Model: "claude-sonnet-4", Status: "ok"}},
+		{Kind: EventKindCustom, Custom: &CustomPayload{Name: "health_check"}},
+		{Kind: EventKindCustom, Custom: &CustomPayload{Name: " skill_invoked "}},
+	} {
+		if chain.Process(&ev) {
+			ch <- ev
+		}
+	}
+	close(ch)
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	if err := worker.Run(ch); err != nil {
+		t.Fatalf("run worker: %v", err)
+	}
+	ctx := context.Background()
+	if row, err := dbm.LatestTrace(ctx); err != nil || row.Provider != "anthropic" {
+		t.Fatalf("latest trace = %+v, %v", row, err)
+	}
+	if count, err := dbm.CustomEventCount(ctx); err != nil || count != 1 {
+		t.Fatalf("custom events = %d, %v; want the health check dropped", count, err)
+	}
+}
@@ -0,0 +1,206 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type SampleTier string
+
+const (
+	// SampleMetadata stores the trace without its text.
+	SampleMetadata SampleTier = "metadata"
+	// SampleDrop only adds the trace to the sampled-out totals.
+	SampleDrop SampleTier = "drop"
+)
+
+func ParseSampleTier(s string) (SampleTier, error) {
+	switch t := SampleTier(s); t {
+	case SampleMetadata, SampleDrop:
+		return t, nil
+	case "":
+		return SampleMetadata, nil
+	default:
+		return "", fmt.Errorf("unknown sample tier %q", s)
+	}
+}
+
+// SampleRule matches traces by provider and model glob; empty fields match anything.
+type SampleRule struct {
+	Provider string     `json:"provider"`
+	Model    string     `json:"model"`
+	Rate     float64    `json:"rate"`
+	Tier     SampleTier `json:"tier"`
+}
+
+func ParseSampleRules(s string) ([]SampleRule, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var rules []SampleRule
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return nil, fmt.Errorf("decode sample rules: %w", err)
+	}
+	return rules, nil
+}
+
+type SampleStats struct {
+	Kept         int64 `json:"kept"`
+	KeptErrors   int64 `json:"kept_errors"`
+	KeptSlow     int64 `json:"kept_slow"`
+	MetadataOnly int64 `json:"metadata_only"`
+	Dropped      int64 `json:"dropped"`
+}
+
+const (
+	sampleWindow    = 1024
+	sampleRecompute = 32
+)
+
+// Sampler always keeps failed and slow traces; the rest keep their text at
+// the rate of the first matching rule.
+type Sampler struct {
+	rules      []SampleRule
+	fallback   SampleRule
+	slowestPct float64
+	random     func() float64
+
+	mu        sync.Mutex
+	latencies []int
+	next      int
+	threshold int
+	pending   int
+
+	kept         atomic.Int64
+	keptErrors   atomic.Int64
+	keptSlow     atomic.Int64
+	metadataOnly atomic.Int64
+	dropped      atomic.Int64
+}
+
+func NewSampler(rules []SampleRule, rate float64, tier SampleTier, slowestPct float64) (*Sampler, error) {
+	if slowestPct < 0 || slowestPct > 100 {
+		return nil, fmt.Errorf("slowest percentage %v is not between 0 and 100", slowestPct)
+	}
+	fallback := SampleRule{Rate: rate, Tier: tier}
+	if err := checkSampleRule(&fallback, SampleMetadata); err != nil {
+		return nil, err
+	}
+	s := &Sampler{fallback: fallback, slowestPct: slowestPct, random: rand.Float64}
+	for _, rule := range rules {
+		if err := checkSampleRule(&rule, fallback.Tier); err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, rule)
+	}
+	return s, nil
+}
+
+func checkSampleRule(rule *SampleRule, defaultTier SampleTier) error {
+	if rule.Rate < 0 || rule.Rate > 1 {
+		return fmt.Errorf("sample rate %v for %q/%q is not between 0 and 1", rule.Rate, rule.Provider, rule.Model)
+	}
+	if _, err := path.Match(rule.Model, ""); err != nil {
+		return fmt.Errorf("sample rule model %q: %w", rule.Model, err)
+	}
+	if rule.Tier == "" {
+		rule.Tier = defaultTier
+	}
+	if _, err := ParseSampleTier(string(rule.Tier)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Sampler) Sample(trace *TracePayload) {
+	slow := s.slow(trace.LatencyMS)
+	switch {
+	case trace.Status != "" && trace.Status != "ok":
+		s.keptErrors.Add(1)
+		return
+	case slow:
+		s.keptSlow.Add(1)
+		return
+	}
+	rule := s.match(trace)
+	if rule.Rate >= 1 || s.random() < rule.Rate {
+		s.kept.Add(1)
+		return
+	}
+
+	if trace.InputInfo == nil {
+		info := DescribeText(trace.InputText)
+		trace.InputInfo = &info
+	}
+	output := DescribeText(trace.OutputText)
+	trace.OutputInfo = &output
+	trace.InputText, trace.OutputText = "", ""
+	if rule.Tier == SampleDrop {
+		trace.SampledOut = true
+		s.dropped.Add(1)
+	} else {
+		trace.TextDropped = true
+		s.metadataOnly.Add(1)
+	}
+}
+
+func (s *Sampler) Process(event *Event) bool {
+	if event.Trace != nil {
+		s.Sample(event.Trace)
+	}
+	return true
+}
+
+func (s *Sampler) Stats() SampleStats {
+	return SampleStats{
+		Kept:         s.kept.Load(),
+		KeptErrors:   s.keptErrors.Load(),
+		KeptSlow:     s.keptSlow.Load(),
+		MetadataOnly: s.metadataOnly.Load(),
+		Dropped:      s.dropped.Load(),
+	}
+}
+
+func (s *Sampler) match(trace *TracePayload) SampleRule {
+	for _, rule := range s.rules {
+		if rule.Provider != "" && rule.Provider != trace.Provider {
+			continue
+		}
+		if rule.Model != "" {
+			if ok, _ := path.Match(rule.Model, trace.Model); !ok {
+				continue
+			}
+		}
+		return rule
+	}
+	return s.fallback
+}
+
+func (s *Sampler) slow(latencyMS int) bool {
+	if s.slowestPct <= 0 || latencyMS <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.latencies) < sampleWindow {
+		s.latencies = append(s.latencies, latencyMS)
+	} else {
+		s.latencies[s.next] = latencyMS
+		s.next = (s.next + 1) % sampleWindow
+	}
+	s.pending++
+	if s.threshold == 0 || s.pending >= sampleRecompute {
+		sorted := slices.Clone(s.latencies)
+		slices.Sort(sorted)
+		i := int(float64(len(sorted)) * (1 - s.slowestPct/100))
+		s.threshold = sorted[min(i, len(sorted)-1)]
+		s.pending = 0
+	}
+	return latencyMS >= s.threshold
+}
@@ -0,0 +1,144 @@
+package ingest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/kon-rad/openclaw-trace/internal/db"
+)
+
+func TestSamplerKeepsFailuresAndSlowTraces(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewSampler(nil, 0, SampleMetadata, 10)
+	if err != nil {
+		t.Fatalf("new sampler: %v", err)
+	}
+	for i := 1; i <= 100; i++ {
+		s.Sample(&TracePayload{Status: "ok", LatencyMS: i, InputText: "in", OutputText: "out"})
+	}
+
+	failed := &TracePayload{Status: "error", LatencyMS: 1, InputText: "in", OutputText: "out"}
+	s.Sample(failed)
+	slow := &TracePayload{Status: "ok", LatencyMS: 500, InputText: "in", OutputText: "out"}
+	s.Sample(slow)
+	fast := &TracePayload{Status: "ok", LatencyMS: 2, InputText: "in", OutputText: "out"}
+	s.Sample(fast)
+
+	if failed.InputText != "in" || failed.TextDropped {
+		t.Fatalf("failed trace was sampled: %+v", failed)
+	}
+	if slow.InputText != "in" || slow.TextDropped {
+		t.Fatalf("slow trace was sampled: %+v", slow)
+	}
+	if fast.InputText != "" || fast.OutputText != "" || !fast.TextDropped || fast.SampledOut {
+		t.Fatalf("fast trace kept its text: %+v", fast)
+	}
+	if fast.InputInfo == nil || fast.InputInfo.Bytes != 2 || fast.OutputInfo == nil || fast.OutputInfo.Bytes != 3 {
+		t.Fatalf("dropped text not described: %+v, %+v", fast.InputInfo, fast.OutputInfo)
+	}
+	stats := s.Stats()
+	if stats.KeptErrors != 1 || stats.KeptSlow < 10 || stats.KeptSlow+stats.MetadataOnly != 102 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestSamplerRulesMatchProviderAndModel(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseSampleRules(`[{"provider":"openai","model":"gpt-4o-mini*","rate":0.5,"tier":"drop"},{"provider":"anthropic","rate":1}]`)
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	s, err := NewSampler(rules, 0, SampleMetadata, 0)
+	if err != nil {
+		t.Fatalf("new sampler: %v", err)
+	}
+	s.random = func() float64 { return 0.7 }
+
+	mini := &TracePayload{Provider: "openai", Model: "gpt-4o-mini-2024-07-18", Status: "ok"}
+	claude := &TracePayload{Provider: "anthropic", Model: "claude-sonnet-4", Status: "ok"}
+	other := &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok"}
+	for _, trace := range []*TracePayload{mini, claude, other} {
+		s.Sample(trace)
+	}
+	if !mini.SampledOut || claude.TextDropped || claude.SampledOut || !other.TextDropped {
+		t.Fatalf("decisions: mini %+v, claude %+v, other %+v", mini, claude, other)
+	}
+
+	for _, bad := range []string{`[{"rate":2}]`, `[{"rate":0.5,"tier":"archive"}]`, `[{"model":"[","rate":0.5}]`} {
+		rules, err := ParseSampleRules(bad)
+		if err == nil {
+			_, err = NewSampler(rules, 1, SampleMetadata, 0)
+		}
+		if err == nil {
+			t.Fatalf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestWorkerStoresSampledTraces(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	s, err := NewSampler([]SampleRule{{Provider: "openai", Rate: 0, Tier: SampleDrop}}, 0, SampleMetadata, 0)
+	if err != nil {
+		t.Fatalf("new sampler: %v", err)
+	}
+	ch := make(chan Event, QueueCapacity)
+	for i := 0; i < 3; i++ {
+		trace := &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok", InputText: "hi", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, CostUSD: 0.25}
+		s.Sample(trace)
+		ch <- Event{Kind: EventKindTrace, CreatedAt: int64(i + 1), Trace: trace}
+	}
+	kept := &TracePayload{Provider: "anthropic", Model: "claude-sonnet-4", Status: "ok", InputText: "hello", OutputText: "world", CostUSD: 1}
+	s.Sample(kept)
+	ch <- Event{Kind: EventKindTrace, CreatedAt: 4, Trace: kept}
+	close(ch)
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	if err := worker.Run(ch); err != nil {
+		t.Fatalf("run worker: %v", err)
+	}
+
+	ctx := context.Background()
+	if count, err := dbm.TraceCount(ctx); err != nil || count != 1 {
+		t.Fatalf("trace count = %d, %v; want only the metadata-only trace", count, err)
+	}
+	row, err := dbm.LatestTrace(ctx)
+	if err != nil {
+		t.Fatalf("latest trace: %v", err)
+	}
+	if !row.TextDropped || row.InputText != "" || row.InputBytes != 5 || row.OutputBytes != 5 || row.InputTruncated || row.CostUSD != 1 {
+		t.Fatalf("metadata-only row = %+v", row)
+	}
+	totals, err := dbm.SampledOutTotals(ctx)
+	if err != nil {
+		t.Fatalf("sampled out totals: %v", err)
+	}
+	if len(totals) != 1 || totals[0] != (db.SampledOutRow{Provider: "openai", Model: "gpt-4o", Traces: 3, PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45, CostUSD: 0.75}) {
+		t.Fatalf("totals = %+v", totals)
+	}
+
+	events, err := dbm.FetchUnsyncedEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("fetch unsynced: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != "sampled_out" || events[1].Type != "llm_trace" {
+		t.Fatalf("push events = %+v", events)
+	}
+	if err := dbm.MarkEventsSynced(ctx, events, 5); err != nil {
+		t.Fatalf("mark synced: %v", err)
+	}
+	if pending, err := dbm.UnsyncedCount(ctx); err != nil || pending != 0 {
+		t.Fatalf("unsynced = %d, %v", pending, err)
+	}
+}
@@ -0,0 +1,315 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultSpillMaxBytes = 64 << 20
+	// Replayed segments are deleted while newer ones still fill.
+	spillSegments     = 4
+	spillSegmentExt   = ".jsonl"
+	minSegmentBytes   = 64 << 10
+	spillSegmentWidth = 16
+)
+
+var ErrSpillFull = errors.New("spill is full")
+
+type SpillStats struct {
+	Pending  int64 `json:"pending_events"`
+	Bytes    int64 `json:"bytes"`
+	Spilled  int64 `json:"events_spilled"`
+	Replayed int64 `json:"events_replayed"`
+	Corrupt  int64 `json:"events_corrupt"`
+}
+
+type spillSegment struct {
+	seq     int64
+	bytes   int64
+	records int64
+}
+
+// Spill is a bounded on-disk overflow for the ingest queue that survives restarts.
+type Spill struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu         sync.Mutex
+	segments   []spillSegment
+	totalBytes int64
+	pending    int64
+	writer     *os.File
+	reader     *os.File
+	readBuf    *bufio.Reader
+	readCount  int64
+
+	spilled  atomic.Int64
+	replayed atomic.Int64
+	corrupt  atomic.Int64
+}
+
+func OpenSpill(dir string, maxBytes int64) (*Spill, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpillMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create spill dir: %w", err)
+	}
+	s := &Spill{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: max(maxBytes/spillSegments, minSegmentBytes),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spill dir: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, spillSegmentExt), 10, 64)
+		if err != nil || !strings.HasSuffix(name, spillSegmentExt) {
+			continue
+		}
+		seg, err := s.scanSegment(seq)
+		if err != nil {
+			return nil, err
+		}
+		if seg.records == 0 {
+			_ = os.Remove(s.path(seq))
+			continue
+		}
+		s.segments = append(s.segments, seg)
+		s.totalBytes += seg.bytes
+		s.pending += seg.records
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	return s, nil
+}
+
+func (s *Spill) path(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%0*d%s", spillSegmentWidth, seq, spillSegmentExt))
+}
+
+func (s *Spill) scanSegment(seq int64) (spillSegment, error) {
+	f, err := os.Open(s.path(seq))
+	if err != nil {
+		return spillSegment{}, fmt.Errorf("open spill segment: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	seg := spillSegment{seq: seq}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		seg.bytes += int64(len(line))
+		if len(line) > 0 {
+			seg.records++
+		}
+		if errors.Is(err, io.EOF) {
+			return seg, nil
+		}
+		if err != nil {
+			return spillSegment{}, fmt.Errorf("scan spill segment: %w", err)
+		}
+	}
+}
+
+// Append gives event a trace id first so an interrupted replay cannot store it twice.
+func (s *Spill) Append(event Event) error {
+	if event.TraceID == "" {
+		event.TraceID = uuid.NewString()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode spilled event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.totalBytes+int64(len(line)) > s.maxBytes {
+		return ErrSpillFull
+	}
+	if s.writer == nil || s.segments[len(s.segments)-1].bytes+int64(len(line)) > s.segmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.writer.Write(line)
+	last := &s.segments[len(s.segments)-1]
+	last.bytes += int64(n)
+	s.totalBytes += int64(n)
+	if n > 0 {
+		last.records++
+		s.pending++
+	}
+	if err != nil {
+		_ = s.writer.Close()
+		s.writer = nil
+		return fmt.Errorf("write spill segment: %w", err)
+	}
+	s.spilled.Add(1)
+	return nil
+}
+
+// rotate never appends to an earlier run's segment, keeping a torn line last.
+func (s *Spill) rotate() error {
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return fmt.Errorf("close spill segment: %w", err)
+		}
+		s.writer = nil
+	}
+	seq := int64(1)
+	if n := len(s.segments); n > 0 {
+		seq = s.segments[n-1].seq + 1
+	}
+	f, err := os.OpenFile(s.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0o640)
+	if err != nil {
+		return fmt.Errorf("create spill segment: %w", err)
+	}
+	s.writer = f
+	s.segments = append(s.segments, spillSegment{seq: seq})
+	return nil
+}
+
+func (s *Spill) Pending() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Read returns up to n of the oldest events, skipping lines that do not decode.
+func (s *Spill) Read(n int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Event
+	for len(out) < n && s.pending > 0 {
+		if s.reader == nil {
+			f, err := os.Open(s.path(s.segments[0].seq))
+			if err != nil {
+				s.dropOldest()
+				return out, fmt.Errorf("open spill segment: %w", err)
+			}
+			s.reader, s.readBuf, s.readCount = f, bufio.NewReader(f), 0
+		}
+
+		if s.readCount >= s.segments[0].records {
+			// The segment being written is removed by reset instead.
+			if len(s.segments) == 1 {
+				break
+			}
+			s.closeReader()
+			s.removeOldest()
+			continue
+		}
+		line, err := s.readBuf.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			s.dropOldest()
+			return out, fmt.Errorf("read spill segment: %w", err)
+		}
+		if len(line) == 0 {
+			// The segment holds fewer lines than counted; give up on it.
+			s.dropOldest()
+			continue
+		}
+		s.readCount++
+		s.pending--
+
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			s.corrupt.Add(1)
+			continue
+		}
+		out = append(out, ev)
+	}
+	s.replayed.Add(int64(len(out)))
+	if s.pending == 0 {
+		s.reset()
+	}
+	return out, nil
+}
+
+func (s *Spill) dropOldest() {
+	s.pending -= s.segments[0].records - s.readCount
+	s.corrupt.Add(s.segments[0].records - s.readCount)
+	if len(s.segments) == 1 && s.writer != nil {
+		_ = s.writer.Close()
+		s.writer = nil
+	}
+	s.closeReader()
+	s.removeOldest()
+}
+
+func (s *Spill) removeOldest() {
+	s.totalBytes -= s.segments[0].bytes
+	_ = os.Remove(s.path(s.segments[0].seq))
+	s.segments = s.segments[1:]
+	s.readCount = 0
+}
+
+// reset deletes every segment once all events have been read.
+func (s *Spill) reset() {
+	s.closeReader()
+	if s.writer != nil {
+		_ = s.writer.Close()
+		s.writer = nil
+	}
+	for _, seg := range s.segments {
+		_ = os.Remove(s.path(seg.seq))
+	}
+	s.segments = nil
+	s.totalBytes = 0
+	s.readCount = 0
+}
+
+func (s *Spill) closeReader() {
+	if s.reader != nil {
+		_ = s.reader.Close()
+		s.reader, s.readBuf = nil, nil
+	}
+}
+
+func (s *Spill) Stats() SpillStats {
+	s.mu.Lock()
+	pending, bytes := s.pending, s.totalBytes
+	s.mu.Unlock()
+	return SpillStats{
+		Pending:  pending,
+		Bytes:    bytes,
+		Spilled:  s.spilled.Load(),
+		Replayed: s.replayed.Load(),
+		Corrupt:  s.corrupt.Load(),
+	}
+}
+
+func (s *Spill) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeReader()
+	if s.writer == nil {
+		return nil
+	}
+	err := s.writer.Sync()
+	if cerr := s.writer.Close(); err == nil {
+		err = cerr
+	}
+	s.writer = nil
+	return err
+}
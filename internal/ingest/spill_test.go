@@ -0,0 +1,228 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/db"
+)
+
+func spillEvent(id string, textBytes int) Event {
+	return Event{
+		Kind:    EventKindTrace,
+		TraceID: id,
+		Trace:   &TracePayload{Provider: "openai", Model: "gpt-4o", InputText: strings.Repeat("x", textBytes)},
+	}
+}
+
+func TestSpillReplaysInOrderAcrossSegments(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "spill")
+	spill, err := OpenSpill(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("open spill: %v", err)
+	}
+	defer func() { _ = spill.Close() }()
+
+	const n = 60
+	for i := range n {
+		if err := spill.Append(spillEvent(fmt.Sprintf("t%03d", i), 10<<10)); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) < 2 {
+		t.Fatalf("segments = %d, want rotation across several", len(entries))
+	}
+
+	var got []string
+	for spill.Pending() > 0 {
+		batch, err := spill.Read(7)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		for _, ev := range batch {
+			got = append(got, ev.TraceID)
+		}
+	}
+	if len(got) != n {
+		t.Fatalf("replayed %d events, want %d", len(got), n)
+	}
+	for i, id := range got {
+		if want := fmt.Sprintf("t%03d", i); id != want {
+			t.Fatalf("event %d = %s, want %s", i, id, want)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("segments left after full replay: %d", len(entries))
+	}
+	if stats := spill.Stats(); stats.Bytes != 0 || stats.Spilled != n || stats.Replayed != n {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestSpillRejectsWhenFull(t *testing.T) {
+	t.Parallel()
+
+	spill, err := OpenSpill(filepath.Join(t.TempDir(), "spill"), 100<<10)
+	if err != nil {
+		t.Fatalf("open spill: %v", err)
+	}
+	defer func() { _ = spill.Close() }()
+
+	accepted := 0
+	for i := range 20 {
+		err := spill.Append(spillEvent(fmt.Sprintf("t%d", i), 10<<10))
+		if errors.Is(err, ErrSpillFull) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		accepted++
+	}
+	if accepted == 0 || accepted >= 20 {
+		t.Fatalf("accepted %d events, want the byte bound to stop appends", accepted)
+	}
+	if stats := spill.Stats(); stats.Bytes > 100<<10 || stats.Pending != int64(accepted) {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestSpillSurvivesRestartAndSkipsTornLine(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "spill")
+	spill, err := OpenSpill(dir, 0)
+	if err != nil {
+		t.Fatalf("open spill: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := spill.Append(spillEvent(id, 10)); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if err := spill.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// Simulate a crash in the middle of an append.
+	f, err := os.OpenFile(spill.path(1), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	_, _ = f.WriteString(`{"Kind":"trace","TraceID":"d"`)
+	_ = f.Close()
+
+	reopened, err := OpenSpill(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen spill: %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if got := reopened.Pending(); got != 4 {
+		t.Fatalf("pending after restart = %d, want 4", got)
+	}
+	if err := reopened.Append(spillEvent("e", 10)); err != nil {
+		t.Fatalf("append after restart: %v", err)
+	}
+
+	events, err := reopened.Read(10)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var ids []string
+	for _, ev := range events {
+		ids = append(ids, ev.TraceID)
+	}
+	if strings.Join(ids, ",") != "a,b,c,e" {
+		t.Fatalf("replayed %v, want a,b,c,e", ids)
+	}
+	if stats := reopened.Stats(); stats.Corrupt != 1 || stats.Pending != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestBackpressureSpillsOverflowAndKeepsOrder(t *testing.T) {
+	t.Parallel()
+
+	spill, err := OpenSpill(filepath.Join(t.TempDir(), "spill"), 0)
+	if err != nil {
+		t.Fatalf("open spill: %v", err)
+	}
+	defer func() { _ = spill.Close() }()
+
+	ch := make(chan Event, 1)
+	bp := NewBackpressure(PolicyDrop, 0)
+	bp.SetSpill(spill)
+
+	for _, id := range []string{"e1", "e2"} {
+		if ok, _ := bp.Enqueue(ch, Event{Kind: EventKindCustom, TraceID: id}); !ok {
+			t.Fatalf("enqueue %s rejected", id)
+		}
+	}
+	<-ch
+	// The channel has room again, but e2 is still on disk, so e3 must follow
+	// it there.
+	if ok, _ := bp.Enqueue(ch, Event{Kind: EventKindCustom, TraceID: "e3"}); !ok {
+		t.Fatalf("enqueue e3 rejected")
+	}
+	if len(ch) != 0 || spill.Pending() != 2 {
+		t.Fatalf("channel depth %d, spill pending %d; want 0 and 2", len(ch), spill.Pending())
+	}
+}
+
+func TestWorkerReplaysSpill(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+	spill, err := OpenSpill(filepath.Join(t.TempDir(), "spill"), 0)
+	if err != nil {
+		t.Fatalf("open spill: %v", err)
+	}
+	defer func() { _ = spill.Close() }()
+	for i := range 120 {
+		ev := spillEvent("", 10)
+		if i%2 == 0 {
+			ev.TraceID = fmt.Sprintf("t%d", i)
+		}
+		if err := spill.Append(ev); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	worker.SetSpill(spill)
+	ch := make(chan Event, QueueCapacity)
+	ch <- spillEvent("first", 10)
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ch) }()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for spill.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	count, err := dbm.TraceCount(context.Background())
+	if err != nil {
+		t.Fatalf("trace count: %v", err)
+	}
+	if count != 121 {
+		t.Fatalf("trace count = %d, want 121", count)
+	}
+}
@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	DefaultMaxClockSkew = 5 * time.Minute
+	DefaultMaxEventAge  = 7 * 24 * time.Hour
+)
+
+// TimeBounds decides whether client-supplied timestamps are plausible
+// relative to the sidecar clock. Timestamps may lead the sidecar by at most
+// MaxSkew and trail it by at most MaxAge; replayed events legitimately arrive
+// late, so MaxAge is much larger than MaxSkew.
+type TimeBounds struct {
+	Now     time.Time
+	MaxSkew time.Duration
+	MaxAge  time.Duration
+}
+
+func NewTimeBounds(now time.Time, maxSkew time.Duration, maxAge time.Duration) TimeBounds {
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxClockSkew
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultMaxEventAge
+	}
+	return TimeBounds{Now: now, MaxSkew: maxSkew, MaxAge: maxAge}
+}
+
+// Offset returns how far ts (unix ms) must be shifted to land on the sidecar
+// clock, or zero when ts is within bounds.
+func (b TimeBounds) Offset(ts int64) int64 {
+	now := b.Now.UnixMilli()
+	if ts > now+b.MaxSkew.Milliseconds() || ts < now-b.MaxAge.Milliseconds() {
+		return now - ts
+	}
+	return 0
+}
+
+// MergeMetadata adds fields to a metadata value. JSON objects are extended in
+// place; any other non-empty value is preserved under "value", decoded when
+// it is valid JSON such as a legacy string value.
+func MergeMetadata(meta string, fields map[string]any) string {
+	if len(fields) == 0 {
+		return meta
+	}
+	merged := map[string]any{}
+	if meta != "" {
+		if err := json.Unmarshal([]byte(meta), &merged); err != nil || merged == nil {
+			var value any = meta
+			if json.Valid([]byte(meta)) {
+				_ = json.Unmarshal([]byte(meta), &value)
+			}
+			merged = map[string]any{"value": value}
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return meta
+	}
+	return string(raw)
+}
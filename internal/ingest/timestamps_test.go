@@ -0,0 +1,55 @@
+package ingest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimeBoundsOffset(t *testing.T) {
+	t.Parallel()
+
+	now := time.UnixMilli(1_700_000_000_000)
+	tb := NewTimeBounds(now, time.Minute, time.Hour)
+
+	if got := tb.Offset(now.Add(30 * time.Second).UnixMilli()); got != 0 {
+		t.Fatalf("offset within skew = %d, want 0", got)
+	}
+	if got := tb.Offset(now.Add(-30 * time.Minute).UnixMilli()); got != 0 {
+		t.Fatalf("offset within age = %d, want 0", got)
+	}
+	if got := tb.Offset(now.Add(2 * time.Minute).UnixMilli()); got != -120_000 {
+		t.Fatalf("offset for future ts = %d, want -120000", got)
+	}
+	if got := tb.Offset(now.Add(-2 * time.Hour).UnixMilli()); got != 7_200_000 {
+		t.Fatalf("offset for stale ts = %d, want 7200000", got)
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		want map[string]any
+	}{
+		{"", map[string]any{"k": "v"}},
+		{`{"req":"1"}`, map[string]any{"req": "1", "k": "v"}},
+		{"plain text", map[string]any{"value": "plain text", "k": "v"}},
+		{`"legacy"`, map[string]any{"value": "legacy", "k": "v"}},
+	}
+	for _, tc := range cases {
+		var got map[string]any
+		if err := json.Unmarshal([]byte(MergeMetadata(tc.in, map[string]any{"k": "v"})), &got); err != nil {
+			t.Fatalf("merge %q produced invalid json: %v", tc.in, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("merge %q = %v, want %v", tc.in, got, tc.want)
+		}
+		for k, v := range tc.want {
+			if got[k] != v {
+				t.Fatalf("merge %q = %v, want %v", tc.in, got, tc.want)
+			}
+		}
+	}
+}
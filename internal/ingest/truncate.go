@@ -1,12 +1,89 @@
 package ingest
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// TruncateMode selects which part of an over-long text is kept.
+type TruncateMode string
+
+const (
+	// TruncateHead keeps the start of the text.
+	TruncateHead TruncateMode = "head"
+	// TruncateHeadTail keeps the start and the end of the text, joined by
+	// TruncationMarker, so the conclusion of a long output survives.
+	TruncateHeadTail TruncateMode = "head_tail"
+)
+
+// TruncationMarker replaces the middle of a text cut by TruncateHeadTail.
+const TruncationMarker = "\n[...truncated...]\n"
+
+func ParseTruncateMode(s string) (TruncateMode, error) {
+	switch m := TruncateMode(s); m {
+	case TruncateHead, TruncateHeadTail:
+		return m, nil
+	case "":
+		return TruncateHead, nil
+	default:
+		return "", fmt.Errorf("unknown truncate mode %q", s)
+	}
+}
+
+// TextInfo describes a text field as it was received, before truncation.
+type TextInfo struct {
+	Bytes  int
+	SHA256 string
+}
+
+// DescribeText returns the size and hex SHA-256 of s. Empty text has no hash.
+func DescribeText(s string) TextInfo {
+	if s == "" {
+		return TextInfo{}
+	}
+	sum := sha256.Sum256([]byte(s))
+	return TextInfo{Bytes: len(s), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// TruncateBytes keeps at most maxBytes of input. The cut is moved back to a
+// rune boundary so the result stays valid UTF-8.
 func TruncateBytes(input string, maxBytes int) string {
 	if maxBytes <= 0 {
 		return ""
 	}
-	raw := []byte(input)
-	if len(raw) <= maxBytes {
+	if len(input) <= maxBytes {
 		return input
 	}
-	return string(raw[:maxBytes])
+	return input[:runeStart(input, maxBytes)]
+}
+
+// TruncateText shortens input to at most maxBytes according to mode. Head and
+// tail each get half of what is left after the marker; when the limit is too
+// small to hold the marker the head is kept.
+func TruncateText(input string, maxBytes int, mode TruncateMode) string {
+	if len(input) <= maxBytes || mode != TruncateHeadTail || maxBytes < 2*len(TruncationMarker) {
+		return TruncateBytes(input, maxBytes)
+	}
+	budget := maxBytes - len(TruncationMarker)
+	head := input[:runeStart(input, budget-budget/2)]
+	tail := input[runeEnd(input, len(input)-budget/2):]
+	return head + TruncationMarker + tail
+}
+
+// runeStart moves i back to the start of the rune it falls in.
+func runeStart(s string, i int) int {
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// runeEnd moves i forward to the start of the next rune.
+func runeEnd(s string, i int) int {
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
 }
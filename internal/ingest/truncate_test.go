@@ -0,0 +1,55 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateBytesKeepsRuneBoundaries(t *testing.T) {
+	t.Parallel()
+
+	// "é" is two bytes and "😀" four, so most limits land inside a rune.
+	input := strings.Repeat("é😀", 10)
+	for limit := range len(input) + 2 {
+		got := TruncateBytes(input, limit)
+		if len(got) > limit || !utf8.ValidString(got) || !strings.HasPrefix(input, got) {
+			t.Fatalf("TruncateBytes(%d) = %q", limit, got)
+		}
+		if limit-len(got) >= utf8.UTFMax {
+			t.Fatalf("TruncateBytes(%d) kept %d bytes, cut too much", limit, len(got))
+		}
+	}
+}
+
+func TestTruncateTextHeadTailKeepsEnd(t *testing.T) {
+	t.Parallel()
+
+	input := "BEGIN " + strings.Repeat("日本語", 100) + " END"
+	got := TruncateText(input, 80, TruncateHeadTail)
+	if len(got) > 80 || !utf8.ValidString(got) {
+		t.Fatalf("head_tail result %q is %d bytes or invalid UTF-8", got, len(got))
+	}
+	if !strings.HasPrefix(got, "BEGIN ") || !strings.HasSuffix(got, " END") || !strings.Contains(got, TruncationMarker) {
+		t.Fatalf("head_tail result %q lost the head, tail or marker", got)
+	}
+
+	if got := TruncateText(input, 20, TruncateHeadTail); got != TruncateBytes(input, 20) {
+		t.Fatalf("limit below marker size = %q, want head only", got)
+	}
+	if got := TruncateText("short", 80, TruncateHeadTail); got != "short" {
+		t.Fatalf("short text changed to %q", got)
+	}
+}
+
+func TestDescribeText(t *testing.T) {
+	t.Parallel()
+
+	info := DescribeText("abc")
+	if info.Bytes != 3 || info.SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("DescribeText = %+v", info)
+	}
+	if info := DescribeText(""); info != (TextInfo{}) {
+		t.Fatalf("empty text described as %+v", info)
+	}
+}
@@ -11,9 +11,11 @@ const (
 type EventKind string
 
 const (
-	EventKindTrace  EventKind = "trace"
-	EventKindError  EventKind = "error"
-	EventKindMetric EventKind = "metric"
+	EventKindTrace    EventKind = "trace"
+	EventKindError    EventKind = "error"
+	EventKindMetric   EventKind = "metric"
+	EventKindCustom   EventKind = "custom"
+	EventKindToolCall EventKind = "tool_call"
 )
 
 type TracePayload struct {
@@ -29,14 +31,44 @@ type TracePayload struct {
 	Status           string
 	ErrorType        string
 	Metadata         string
+
+	// Optional hierarchy identifiers that let an agent turn be rebuilt as a
+	// tree: a session holds runs, a run holds spans linked by parent span.
+	SessionID    string
+	RunID        string
+	SpanID       string
+	ParentSpanID string
+
+	// Client-side call boundaries in unix milliseconds; zero when unknown.
+	StartedAt int64
+	EndedAt   int64
+
+	// Streaming timings; zero when the call was not tracked as a stream.
+	TTFTMS       int
+	TokensPerSec float64
+
+	// InputInfo describes InputText before an earlier truncation, such as
+	// the stream tracker's; nil when InputText is the text as received.
+	// OutputInfo does the same for OutputText.
+	InputInfo  *TextInfo
+	OutputInfo *TextInfo
+
+	// Set by the Sampler: TextDropped traces are stored without text,
+	// SampledOut traces only add to the sampled-out totals.
+	TextDropped bool
+	SampledOut  bool
 }
 
+// ErrorPayload is an error reported by the agent or raised by the sidecar.
+// LLMTraceID optionally names the trace the error belongs to; unlike the
+// event's TraceID it need not be unique.
 type ErrorPayload struct {
 	ErrorType  string
 	Message    string
 	StackTrace string
 	Severity   string
 	Metadata   string
+	LLMTraceID string
 }
 
 type MetricPayload struct {
@@ -50,12 +82,48 @@ type MetricPayload struct {
 	Metadata      string
 }
 
+// CustomPayload is an arbitrary named event reported by the agent. Attributes
+// holds a JSON object encoded as text.
+type CustomPayload struct {
+	Name       string
+	Attributes string
+	Metadata   string
+}
+
+// ToolCallPayload is one tool invocation made by the agent: a web fetch,
+// shell command, MCP request and so on. LLMTraceID optionally names the trace
+// of the LLM call that requested the tool.
+type ToolCallPayload struct {
+	ToolName     string
+	Arguments    string
+	ResultBytes  int64
+	DurationMS   int
+	Status       string
+	ErrorType    string
+	ErrorMessage string
+	LLMTraceID   string
+	Metadata     string
+
+	SessionID    string
+	RunID        string
+	SpanID       string
+	ParentSpanID string
+
+	StartedAt int64
+	EndedAt   int64
+}
+
 type Event struct {
-	Kind      EventKind
+	Kind EventKind
+	// TraceID is the row key. Clients may supply it so that retried
+	// deliveries collapse into one row; the worker generates one otherwise.
+	TraceID   string
 	CreatedAt int64
 	Trace     *TracePayload
 	Error     *ErrorPayload
 	Metric    *MetricPayload
+	Custom    *CustomPayload
+	ToolCall  *ToolCallPayload
 }
 
 func TryEnqueue(ch chan Event, event Event) bool {
@@ -2,119 +2,188 @@ package ingest
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/kon-rad/openclaw-trace/internal/db"
 )
 
+// WorkerState is reported in /health.
+type WorkerState string
+
+const (
+	WorkerRunning    WorkerState = "running"
+	WorkerRestarting WorkerState = "restarting"
+	WorkerStopped    WorkerState = "stopped"
+)
+
+const (
+	minRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff = 10 * time.Second
+)
+
 type Worker struct {
 	logger       *slog.Logger
 	dbm          *db.Manager
 	maxTextBytes int
+	truncateMode TruncateMode
+	spill        *Spill
+
+	// retry holds the batch whose flush failed; only the worker goroutine
+	// touches it.
+	retry []Event
+
+	duplicates   atomic.Int64
+	deadLettered atomic.Int64
+	state        atomic.Value
+	restarts     atomic.Int64
+	failures     atomic.Int64
+	lastError    atomic.Value
 }
 
 func NewWorker(logger *slog.Logger, dbm *db.Manager, maxTextBytes int) *Worker {
-	return &Worker{
+	w := &Worker{
 		logger:       logger,
 		dbm:          dbm,
 		maxTextBytes: maxTextBytes,
 	}
+	w.state.Store(string(WorkerStopped))
+	w.lastError.Store("")
+	return w
+}
+
+// Duplicates returns how many events were skipped because their trace_id was
+// already stored.
+func (w *Worker) Duplicates() int64 {
+	return w.duplicates.Load()
+}
+
+// DeadLettered returns how many events were moved to the dead-letter table
+// because they could not be stored.
+func (w *Worker) DeadLettered() int64 {
+	return w.deadLettered.Load()
+}
+
+func (w *Worker) State() WorkerState {
+	return WorkerState(w.state.Load().(string))
+}
+
+// Restarts returns how many times Supervise restarted the worker.
+func (w *Worker) Restarts() int64 {
+	return w.restarts.Load()
+}
+
+// Failing reports whether the last flush failed, that is whether events are
+// currently not being persisted.
+func (w *Worker) Failing() bool {
+	return w.failures.Load() > 0
+}
+
+// LastError returns the most recent flush error, or "" if none occurred.
+func (w *Worker) LastError() string {
+	return w.lastError.Load().(string)
+}
+
+// SetTruncateMode selects how over-long texts are shortened; the default
+// keeps their head.
+func (w *Worker) SetTruncateMode(mode TruncateMode) {
+	w.truncateMode = mode
 }
 
+// SetSpill makes the worker replay spilled events whenever the channel is
+// empty.
+func (w *Worker) SetSpill(spill *Spill) {
+	w.spill = spill
+}
+
+// Run consumes events until the channel is closed or a flush fails.
 func (w *Worker) Run(events <-chan Event) error {
+	_, err := w.run(events)
+	return err
+}
+
+// Supervise runs the worker until events is closed, restarting it with
+// exponential backoff whenever a flush fails. The failed batch is retried
+// before anything newer, so a passing outage loses nothing. Once ctx is done
+// it stops restarting and spills the failed batch instead, so that shutdown
+// does not wait on an outage that has not passed.
+func (w *Worker) Supervise(ctx context.Context, events <-chan Event) error {
+	for {
+		w.state.Store(string(WorkerRunning))
+		closed, err := w.run(events)
+		if closed || ctx.Err() != nil {
+			w.state.Store(string(WorkerStopped))
+			if err != nil {
+				w.spillRetry()
+			}
+			return err
+		}
+		restarts := w.restarts.Add(1)
+		backoff := restartBackoff(w.failures.Load())
+		w.state.Store(string(WorkerRestarting))
+		w.logger.Error("ingest worker failed, restarting", "error", err, "restarts", restarts, "backoff", backoff.String())
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			w.state.Store(string(WorkerStopped))
+			w.spillRetry()
+			return err
+		}
+	}
+}
+
+// run reports whether it returned because events was closed.
+func (w *Worker) run(events <-chan Event) (bool, error) {
+	if len(w.retry) > 0 {
+		if err := w.flush(w.retry); err != nil {
+			return false, err
+		}
+	}
+
 	ticker := time.NewTicker(FlushWindow)
 	defer ticker.Stop()
 
 	buffer := make([]Event, 0, MaxBatchSize)
 
-	flush := func(batch []Event) error {
-		if len(batch) == 0 {
-			return nil
-		}
-		traces := make([]db.TraceInsert, 0, len(batch))
-		errs := make([]db.ErrorInsert, 0, len(batch))
-		metrics := make([]db.MetricInsert, 0, len(batch))
-		for _, ev := range batch {
-			traceID := uuid.NewString()
-			createdAt := ev.CreatedAt
-			if createdAt == 0 {
-				createdAt = time.Now().UnixMilli()
-			}
-			switch ev.Kind {
-			case EventKindTrace:
-				if ev.Trace == nil {
-					continue
-				}
-				traces = append(traces, db.TraceInsert{
-					TraceID:          traceID,
-					CreatedAt:        createdAt,
-					Provider:         ev.Trace.Provider,
-					Model:            ev.Trace.Model,
-					InputText:        TruncateBytes(ev.Trace.InputText, w.maxTextBytes),
-					OutputText:       TruncateBytes(ev.Trace.OutputText, w.maxTextBytes),
-					PromptTokens:     ev.Trace.PromptTokens,
-					CompletionTokens: ev.Trace.CompletionTokens,
-					TotalTokens:      ev.Trace.TotalTokens,
-					CostUSD:          ev.Trace.CostUSD,
-					LatencyMS:        ev.Trace.LatencyMS,
-					Status:           ev.Trace.Status,
-					ErrorType:        ev.Trace.ErrorType,
-					Metadata:         ev.Trace.Metadata,
-				})
-			case EventKindError:
-				if ev.Error == nil {
-					continue
-				}
-				errs = append(errs, db.ErrorInsert{
-					TraceID:    traceID,
-					CreatedAt:  createdAt,
-					ErrorType:  ev.Error.ErrorType,
-					Message:    ev.Error.Message,
-					StackTrace: ev.Error.StackTrace,
-					Severity:   ev.Error.Severity,
-					Metadata:   ev.Error.Metadata,
-				})
-			case EventKindMetric:
-				if ev.Metric == nil {
-					continue
-				}
-				metrics = append(metrics, db.MetricInsert{
-					TraceID:       traceID,
-					CreatedAt:     createdAt,
-					CPUPct:        ev.Metric.CPUPct,
-					MemRSSBytes:   ev.Metric.MemRSSBytes,
-					MemAvailable:  ev.Metric.MemAvailable,
-					MemTotal:      ev.Metric.MemTotal,
-					DiskUsedBytes: ev.Metric.DiskUsedBytes,
-					DiskTotal:     ev.Metric.DiskTotal,
-					DiskFreeBytes: ev.Metric.DiskFreeBytes,
-					Metadata:      ev.Metric.Metadata,
-				})
-			}
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
-		if err := w.dbm.InsertBatch(ctx, traces, errs, metrics); err != nil {
-			return fmt.Errorf("insert batch: %w", err)
-		}
-		return nil
-	}
+	// replayReady is always ready; it is selected only while spilled events
+	// wait and the channel is empty, since anything in the channel is older.
+	replayReady := make(chan struct{})
+	close(replayReady)
 
 	for {
+		var replay <-chan struct{}
+		if w.spill != nil && len(events) == 0 && w.spill.Pending() > 0 {
+			replay = replayReady
+		}
 		select {
+		case <-replay:
+			replayed, err := w.spill.Read(MaxBatchSize - len(buffer))
+			if err != nil {
+				w.logger.Warn("spill replay skipped a segment", "error", err)
+			}
+			buffer = append(buffer, replayed...)
+			if len(buffer) >= MaxBatchSize {
+				if err := w.flush(buffer); err != nil {
+					w.logger.Error("ingest flush failed", "error", err)
+					return false, err
+				}
+				buffer = buffer[:0]
+			}
 		case ev, ok := <-events:
 			if !ok {
-				return flush(buffer)
+				return true, w.flush(buffer)
 			}
 			buffer = append(buffer, ev)
 			if len(buffer) >= MaxBatchSize {
-				if err := flush(buffer); err != nil {
+				if err := w.flush(buffer); err != nil {
 					w.logger.Error("ingest flush failed", "error", err)
-					return err
+					return false, err
 				}
 				buffer = buffer[:0]
 			}
@@ -122,11 +191,312 @@ func (w *Worker) Run(events <-chan Event) error {
 			if len(buffer) == 0 {
 				continue
 			}
-			if err := flush(buffer); err != nil {
+			if err := w.flush(buffer); err != nil {
 				w.logger.Error("ingest timed flush failed", "error", err)
-				return err
+				return false, err
 			}
 			buffer = buffer[:0]
 		}
 	}
 }
+
+// flush inserts batch. A batch rejected because of its contents is split to
+// find the offending events, see isolate. On any other failure a copy is kept
+// as the retry batch and the failure is counted until a later flush succeeds.
+func (w *Worker) flush(batch []Event) error {
+	// Trace ids are fixed before the first attempt, so events committed by a
+	// partial isolate are skipped as duplicates when the batch is retried.
+	for i := range batch {
+		if batch[i].TraceID == "" {
+			batch[i].TraceID = uuid.NewString()
+		}
+	}
+	sampled := sampledOutRows(batch)
+	err := w.insert(batch, sampled)
+	if err != nil && db.IsDataError(err) {
+		err = w.isolate(batch, sampled, err)
+	}
+	if err != nil {
+		w.retry = append([]Event(nil), batch...)
+		w.failures.Add(1)
+		w.lastError.Store(err.Error())
+		return err
+	}
+	w.retry = nil
+	w.failures.Store(0)
+	return nil
+}
+
+// isolate bisects a batch that failed with a data error: each half is
+// inserted on its own and a failing half is split again, until the events
+// that cannot be stored are alone and go to the dead-letter table. It returns
+// early on any error that is not caused by the data. The sampled-out totals
+// of the whole batch are stored first, on their own.
+func (w *Worker) isolate(batch []Event, sampled []db.SampledOutInsert, cause error) error {
+	if len(sampled) > 0 {
+		if err := w.insert(nil, sampled); err != nil {
+			return err
+		}
+	}
+	if len(batch) == 1 {
+		return w.deadLetter(batch[0], cause)
+	}
+	mid := len(batch) / 2
+	for _, half := range [][]Event{batch[:mid], batch[mid:]} {
+		err := w.insert(half, nil)
+		if err == nil {
+			continue
+		}
+		if !db.IsDataError(err) {
+			return err
+		}
+		if err := w.isolate(half, nil, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) deadLetter(ev Event, cause error) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encode dead letter: %w", err)
+	}
+	createdAt := ev.CreatedAt
+	if createdAt == 0 {
+		createdAt = time.Now().UnixMilli()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := w.dbm.InsertDeadLetters(ctx, []db.DeadLetterInsert{{
+		CreatedAt: createdAt,
+		Kind:      string(ev.Kind),
+		TraceID:   ev.TraceID,
+		Payload:   string(payload),
+		Error:     cause.Error(),
+	}}); err != nil {
+		return fmt.Errorf("dead letter: %w", err)
+	}
+	w.deadLettered.Add(1)
+	w.logger.Warn("event dead-lettered", "kind", ev.Kind, "trace_id", ev.TraceID, "error", cause)
+	return nil
+}
+
+func (w *Worker) insert(batch []Event, sampled []db.SampledOutInsert) error {
+	if len(batch) == 0 && len(sampled) == 0 {
+		return nil
+	}
+	rows := db.Batch{SampledOut: sampled}
+	for _, ev := range batch {
+		traceID := ev.TraceID
+		createdAt := ev.CreatedAt
+		if createdAt == 0 {
+			createdAt = time.Now().UnixMilli()
+		}
+		switch ev.Kind {
+		case EventKindTrace:
+			if ev.Trace == nil {
+				continue
+			}
+			if ev.Trace.SampledOut {
+				continue
+			}
+			input := DescribeText(ev.Trace.InputText)
+			if ev.Trace.InputInfo != nil {
+				input = *ev.Trace.InputInfo
+			}
+			output := DescribeText(ev.Trace.OutputText)
+			if ev.Trace.OutputInfo != nil {
+				output = *ev.Trace.OutputInfo
+			}
+			inputText := w.truncate(ev.Trace.InputText)
+			outputText := w.truncate(ev.Trace.OutputText)
+			var inputSegments []string
+			if inputText != ev.Trace.InputText {
+				// Split before cutting: a cut message array no longer parses,
+				// and its system prompt would miss the blob it shares.
+				inputSegments = db.SplitMessages(ev.Trace.InputText)
+				for i, segment := range inputSegments {
+					inputSegments[i] = w.truncate(segment)
+				}
+			}
+			rows.Traces = append(rows.Traces, db.TraceInsert{
+				TraceID:          traceID,
+				CreatedAt:        createdAt,
+				Provider:         ev.Trace.Provider,
+				Model:            ev.Trace.Model,
+				InputText:        inputText,
+				OutputText:       outputText,
+				PromptTokens:     ev.Trace.PromptTokens,
+				CompletionTokens: ev.Trace.CompletionTokens,
+				TotalTokens:      ev.Trace.TotalTokens,
+				CostUSD:          ev.Trace.CostUSD,
+				LatencyMS:        ev.Trace.LatencyMS,
+				Status:           ev.Trace.Status,
+				ErrorType:        ev.Trace.ErrorType,
+				Metadata:         ev.Trace.Metadata,
+				SessionID:        ev.Trace.SessionID,
+				RunID:            ev.Trace.RunID,
+				SpanID:           ev.Trace.SpanID,
+				ParentSpanID:     ev.Trace.ParentSpanID,
+				StartedAt:        ev.Trace.StartedAt,
+				EndedAt:          ev.Trace.EndedAt,
+				TTFTMS:           ev.Trace.TTFTMS,
+				TokensPerSec:     ev.Trace.TokensPerSec,
+				InputTruncated:   !ev.Trace.TextDropped && input.Bytes > len(inputText),
+				OutputTruncated:  !ev.Trace.TextDropped && output.Bytes > len(outputText),
+				TextDropped:      ev.Trace.TextDropped,
+				InputBytes:       input.Bytes,
+				OutputBytes:      output.Bytes,
+				InputSHA256:      input.SHA256,
+				OutputSHA256:     output.SHA256,
+				InputSegments:    inputSegments,
+			})
+		case EventKindError:
+			if ev.Error == nil {
+				continue
+			}
+			rows.Errors = append(rows.Errors, db.ErrorInsert{
+				TraceID:    traceID,
+				CreatedAt:  createdAt,
+				LLMTraceID: ev.Error.LLMTraceID,
+				ErrorType:  ev.Error.ErrorType,
+				Message:    ev.Error.Message,
+				StackTrace: ev.Error.StackTrace,
+				Severity:   ev.Error.Severity,
+				Metadata:   ev.Error.Metadata,
+			})
+		case EventKindMetric:
+			if ev.Metric == nil {
+				continue
+			}
+			rows.Metrics = append(rows.Metrics, db.MetricInsert{
+				TraceID:       traceID,
+				CreatedAt:     createdAt,
+				CPUPct:        ev.Metric.CPUPct,
+				MemRSSBytes:   ev.Metric.MemRSSBytes,
+				MemAvailable:  ev.Metric.MemAvailable,
+				MemTotal:      ev.Metric.MemTotal,
+				DiskUsedBytes: ev.Metric.DiskUsedBytes,
+				DiskTotal:     ev.Metric.DiskTotal,
+				DiskFreeBytes: ev.Metric.DiskFreeBytes,
+				Metadata:      ev.Metric.Metadata,
+			})
+		case EventKindCustom:
+			if ev.Custom == nil {
+				continue
+			}
+			rows.CustomEvents = append(rows.CustomEvents, db.CustomEventInsert{
+				TraceID:    traceID,
+				CreatedAt:  createdAt,
+				Name:       ev.Custom.Name,
+				Attributes: ev.Custom.Attributes,
+				Metadata:   ev.Custom.Metadata,
+			})
+		case EventKindToolCall:
+			if ev.ToolCall == nil {
+				continue
+			}
+			rows.ToolCalls = append(rows.ToolCalls, db.ToolCallInsert{
+				TraceID:      traceID,
+				CreatedAt:    createdAt,
+				LLMTraceID:   ev.ToolCall.LLMTraceID,
+				ToolName:     ev.ToolCall.ToolName,
+				Arguments:    w.truncate(ev.ToolCall.Arguments),
+				ResultBytes:  ev.ToolCall.ResultBytes,
+				DurationMS:   ev.ToolCall.DurationMS,
+				Status:       ev.ToolCall.Status,
+				ErrorType:    ev.ToolCall.ErrorType,
+				ErrorMessage: w.truncate(ev.ToolCall.ErrorMessage),
+				Metadata:     ev.ToolCall.Metadata,
+				SessionID:    ev.ToolCall.SessionID,
+				RunID:        ev.ToolCall.RunID,
+				SpanID:       ev.ToolCall.SpanID,
+				ParentSpanID: ev.ToolCall.ParentSpanID,
+				StartedAt:    ev.ToolCall.StartedAt,
+				EndedAt:      ev.ToolCall.EndedAt,
+			})
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := w.dbm.InsertBatch(ctx, rows)
+	if err != nil {
+		return fmt.Errorf("insert batch: %w", err)
+	}
+	if res.Duplicates > 0 {
+		w.duplicates.Add(int64(res.Duplicates))
+	}
+	return nil
+}
+
+// sampledOutRows totals the sampled-out traces of batch per provider and
+// model. Each row id is derived from the trace ids it counts, so a retried
+// batch collides with the rows it already stored instead of counting twice.
+func sampledOutRows(batch []Event) []db.SampledOutInsert {
+	totals := map[[2]string]*db.SampledOutInsert{}
+	members := map[[2]string][]string{}
+	var keys [][2]string
+	for _, ev := range batch {
+		trace := ev.Trace
+		if ev.Kind != EventKindTrace || trace == nil || !trace.SampledOut {
+			continue
+		}
+		key := [2]string{trace.Provider, trace.Model}
+		row := totals[key]
+		if row == nil {
+			row = &db.SampledOutInsert{Provider: trace.Provider, Model: trace.Model}
+			totals[key] = row
+			keys = append(keys, key)
+		}
+		createdAt := ev.CreatedAt
+		if createdAt == 0 {
+			createdAt = time.Now().UnixMilli()
+		}
+		row.CreatedAt = max(row.CreatedAt, createdAt)
+		row.Traces++
+		row.PromptTokens += trace.PromptTokens
+		row.CompletionTokens += trace.CompletionTokens
+		row.TotalTokens += trace.TotalTokens
+		row.CostUSD += trace.CostUSD
+		members[key] = append(members[key], ev.TraceID)
+	}
+
+	rows := make([]db.SampledOutInsert, 0, len(keys))
+	for _, key := range keys {
+		ids := members[key]
+		slices.Sort(ids)
+		row := totals[key]
+		row.TraceID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(strings.Join(append(key[:], ids...), "\x00"))).String()
+		rows = append(rows, *row)
+	}
+	return rows
+}
+
+func (w *Worker) truncate(text string) string {
+	return TruncateText(text, w.maxTextBytes, w.truncateMode)
+}
+
+// restartBackoff doubles from minRestartBackoff with each consecutive
+// failure, up to maxRestartBackoff.
+func restartBackoff(failures int64) time.Duration {
+	backoff := minRestartBackoff
+	for i := int64(1); i < failures && backoff < maxRestartBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRestartBackoff)
+}
+
+// spillRetry keeps the retry batch for the next start when the final flush
+// fails at shutdown.
+func (w *Worker) spillRetry() {
+	if w.spill == nil || len(w.retry) == 0 {
+		return
+	}
+	for _, ev := range w.retry {
+		if err := w.spill.Append(ev); err != nil {
+			w.logger.Error("could not spill unflushed event", "error", err)
+		}
+	}
+	w.retry = nil
+}
@@ -2,9 +2,13 @@ package ingest
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,4 +115,407 @@ func TestWorkerGeneratesTraceIDAndTruncatesText(t *testing.T) {
 	if len([]byte(output)) != 8 {
 		t.Fatalf("output bytes = %d, want 8", len([]byte(output)))
 	}
+
+	row, err := dbm.LatestTrace(context.Background())
+	if err != nil {
+		t.Fatalf("latest trace: %v", err)
+	}
+	if !row.InputTruncated || !row.OutputTruncated || row.InputBytes != 16 || row.OutputBytes != 11 {
+		t.Fatalf("truncation not recorded: %+v", row)
+	}
+	if row.InputSHA256 != DescribeText("0123456789abcdef").SHA256 {
+		t.Fatalf("input hash = %q, want hash of the full input", row.InputSHA256)
+	}
+}
+
+func TestWorkerSuppressesDuplicateTraceIDs(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	ch := make(chan Event, QueueCapacity)
+	done := make(chan error, 1)
+	go func() {
+		done <- worker.Run(ch)
+	}()
+
+	for i := 0; i < 3; i++ {
+		ch <- Event{
+			Kind:    EventKindTrace,
+			TraceID: "agent-call-42",
+			Trace: &TracePayload{
+				Provider: "anthropic",
+				Model:    "claude-sonnet-4",
+				Status:   "ok",
+			},
+		}
+	}
+	ch <- Event{
+		Kind:    EventKindError,
+		TraceID: "agent-call-42",
+		Error:   &ErrorPayload{ErrorType: "llm_error", Message: "m", Severity: "error"},
+	}
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("worker returned error: %v", err)
+	}
+
+	count, err := dbm.TraceCount(context.Background())
+	if err != nil {
+		t.Fatalf("trace count query failed: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("trace count = %d, want 1", count)
+	}
+	errCount, err := dbm.ErrorCount(context.Background())
+	if err != nil {
+		t.Fatalf("error count query failed: %v", err)
+	}
+	if errCount != 1 {
+		t.Fatalf("error count = %d, want 1", errCount)
+	}
+	if got := worker.Duplicates(); got != 2 {
+		t.Fatalf("duplicates = %d, want 2", got)
+	}
+}
+
+func TestSuperviseRestartsAndRetriesFailedBatch(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	// A second connection installs a trigger that fails every trace insert
+	// with an abort IsDataError treats as transient, standing in for a full
+	// disk.
+	raw, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open raw db: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	if _, err := raw.Exec(`CREATE TRIGGER fail_traces BEFORE INSERT ON llm_traces BEGIN SELECT RAISE(ABORT, 'prompt blob ref: simulated outage'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	ch := make(chan Event, QueueCapacity)
+	done := make(chan error, 1)
+	go func() { done <- worker.Supervise(context.Background(), ch) }()
+
+	for i := range 3 {
+		ch <- Event{Kind: EventKindTrace, TraceID: fmt.Sprintf("t%d", i), Trace: &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok"}}
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("restarts", func() bool { return worker.Restarts() >= 2 && worker.Failing() })
+	if worker.LastError() == "" {
+		t.Fatalf("expected last error to be recorded")
+	}
+
+	if _, err := raw.Exec(`DROP TRIGGER fail_traces`); err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	waitFor("recovery", func() bool { return !worker.Failing() })
+	if got := worker.State(); got != WorkerRunning {
+		t.Fatalf("state = %s, want running", got)
+	}
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("supervise error: %v", err)
+	}
+	if got := worker.State(); got != WorkerStopped {
+		t.Fatalf("state after close = %s, want stopped", got)
+	}
+	count, err := dbm.TraceCount(context.Background())
+	if err != nil {
+		t.Fatalf("trace count: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("trace count = %d, want the failed batch retried", count)
+	}
+}
+
+func TestSuperviseStopsOnShutdownDuringOutage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+	raw, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open raw db: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	if _, err := raw.Exec(`ALTER TABLE llm_traces RENAME TO llm_traces_offline`); err != nil {
+		t.Fatalf("rename table: %v", err)
+	}
+	spill, err := OpenSpill(filepath.Join(dir, "spill"), 1<<20)
+	if err != nil {
+		t.Fatalf("open spill: %v", err)
+	}
+	defer func() { _ = spill.Close() }()
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	worker.SetSpill(spill)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan Event, QueueCapacity)
+	done := make(chan error, 1)
+	go func() { done <- worker.Supervise(ctx, ch) }()
+
+	for i := range 3 {
+		ch <- Event{Kind: EventKindTrace, TraceID: fmt.Sprintf("t%d", i), Trace: &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok"}}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for worker.Restarts() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for a restart")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The channel stays open: shutdown must not depend on the worker
+	// reaching it.
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected the outage error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("supervise did not stop after shutdown")
+	}
+	if got := worker.State(); got != WorkerStopped {
+		t.Fatalf("state = %s, want stopped", got)
+	}
+	if got := spill.Pending(); got != 3 {
+		t.Fatalf("spilled = %d, want the failed batch", got)
+	}
+}
+
+func TestRestartBackoffIsCapped(t *testing.T) {
+	t.Parallel()
+
+	if got := restartBackoff(1); got != minRestartBackoff {
+		t.Fatalf("first backoff = %s, want %s", got, minRestartBackoff)
+	}
+	if got := restartBackoff(3); got != 4*minRestartBackoff {
+		t.Fatalf("third backoff = %s, want %s", got, 4*minRestartBackoff)
+	}
+	if got := restartBackoff(100); got != maxRestartBackoff {
+		t.Fatalf("backoff after many failures = %s, want %s", got, maxRestartBackoff)
+	}
+}
+
+func TestWorkerDeadLettersPoisonEvents(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	ch := make(chan Event, QueueCapacity)
+	for i := range 10 {
+		ev := Event{Kind: EventKindTrace, TraceID: fmt.Sprintf("t%d", i), Trace: &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok"}}
+		if i == 3 || i == 8 {
+			// Attributes must be valid JSON, so these rows violate a CHECK
+			// constraint however often they are retried.
+			ev = Event{Kind: EventKindCustom, TraceID: fmt.Sprintf("bad%d", i), Custom: &CustomPayload{Name: "step", Attributes: "{not json"}}
+		}
+		ch <- ev
+	}
+	close(ch)
+	if err := worker.Run(ch); err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	ctx := context.Background()
+	count, err := dbm.TraceCount(ctx)
+	if err != nil {
+		t.Fatalf("trace count: %v", err)
+	}
+	if count != 8 {
+		t.Fatalf("trace count = %d, want every good event stored", count)
+	}
+	letters, err := dbm.ListDeadLetters(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("list dead letters: %v", err)
+	}
+	if len(letters) != 2 || worker.DeadLettered() != 2 {
+		t.Fatalf("dead letters = %+v, counter %d; want 2", letters, worker.DeadLettered())
+	}
+	for _, letter := range letters {
+		if letter.Kind != string(EventKindCustom) || letter.Error == "" {
+			t.Fatalf("unexpected dead letter: %+v", letter)
+		}
+		var ev Event
+		if err := json.Unmarshal([]byte(letter.Payload), &ev); err != nil || ev.TraceID != letter.TraceID || ev.Custom == nil {
+			t.Fatalf("payload %s does not round-trip: %v", letter.Payload, err)
+		}
+	}
+	if worker.Failing() {
+		t.Fatalf("worker reports failing after isolating poison events")
+	}
+}
+
+func TestWorkerSplitsTruncatedInputIntoSharedBlobs(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+	dbm.SetPromptStore(db.PromptStoreSegments, 64)
+
+	system := `{"role":"system","content":"` + strings.Repeat("Be careful. ", 8) + `"}`
+	long := fmt.Sprintf(`[%s,{"role":"user","content":"turn"},{"role":"user","content":"%s"}]`, system, strings.Repeat("x", 600))
+	short := fmt.Sprintf(`[%s,{"role":"user","content":"hi"},{"role":"user","content":"bye"}]`, system)
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 256)
+	if len(short) > 256 || len(long) <= 256 {
+		t.Fatalf("inputs are %d and %d bytes, want one on each side of the limit", len(short), len(long))
+	}
+	ch := make(chan Event, QueueCapacity)
+	ch <- Event{Kind: EventKindTrace, TraceID: "long", Trace: &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok", InputText: long}}
+	ch <- Event{Kind: EventKindTrace, TraceID: "short", Trace: &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok", InputText: short}}
+	close(ch)
+	if err := worker.Run(ch); err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	raw, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open raw db: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	var refs int
+	if err := raw.QueryRow(`SELECT refs FROM prompt_blobs WHERE content = ?`, "["+system).Scan(&refs); err != nil || refs != 2 {
+		t.Fatalf("system prompt blob refs = %d, %v; want it shared by both traces", refs, err)
+	}
+	var truncated bool
+	var inputBytes int
+	if err := raw.QueryRow(`SELECT input_truncated, input_bytes FROM llm_traces WHERE trace_id = 'long'`).Scan(&truncated, &inputBytes); err != nil || !truncated || inputBytes != len(long) {
+		t.Fatalf("long trace truncated = %v, bytes = %d, %v", truncated, inputBytes, err)
+	}
+}
+
+func TestWorkerDeadLettersRowsRejectedByTrigger(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	raw, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open raw db: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	if _, err := raw.Exec(`CREATE TRIGGER reject_traces BEFORE INSERT ON llm_traces WHEN NEW.model = 'banned' BEGIN SELECT RAISE(ABORT, 'model not allowed'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	ch := make(chan Event, QueueCapacity)
+	for i := range 4 {
+		model := "gpt-4o"
+		if i == 2 {
+			model = "banned"
+		}
+		ch <- Event{Kind: EventKindTrace, TraceID: fmt.Sprintf("t%d", i), Trace: &TracePayload{Provider: "openai", Model: model, Status: "ok"}}
+	}
+	close(ch)
+	if err := worker.Run(ch); err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	ctx := context.Background()
+	if count, err := dbm.TraceCount(ctx); err != nil || count != 3 {
+		t.Fatalf("trace count = %d, %v; want the other traces stored", count, err)
+	}
+	letters, err := dbm.ListDeadLetters(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("list dead letters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].TraceID != "t2" || !strings.Contains(letters[0].Error, "model not allowed") {
+		t.Fatalf("dead letters = %+v, want the rejected trace", letters)
+	}
+}
+
+func TestWorkerRetryAfterPartialIsolateCountsSampledOnce(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	// Tool calls fail with an error that is not a data error, so isolating
+	// the poison event below commits part of the batch and then gives up.
+	raw, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open raw db: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	if _, err := raw.Exec(`CREATE TRIGGER fail_tools BEFORE INSERT ON tool_calls BEGIN SELECT RAISE(ABORT, 'prompt blob ref: simulated outage'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	batch := []Event{
+		{Kind: EventKindTrace, Trace: &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok", TotalTokens: 10, SampledOut: true}},
+		{Kind: EventKindTrace, Trace: &TracePayload{Provider: "openai", Model: "gpt-4o", Status: "ok", TotalTokens: 20, SampledOut: true}},
+		{Kind: EventKindCustom, Custom: &CustomPayload{Name: "step", Attributes: "{not json"}},
+		{Kind: EventKindToolCall, ToolCall: &ToolCallPayload{ToolName: "web_fetch", Status: "ok"}},
+	}
+	worker := NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	if err := worker.flush(batch); err == nil {
+		t.Fatalf("expected the tool call insert to fail")
+	}
+	if _, err := raw.Exec(`DROP TRIGGER fail_tools`); err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	if err := worker.flush(worker.retry); err != nil {
+		t.Fatalf("retry flush: %v", err)
+	}
+
+	totals, err := dbm.SampledOutTotals(context.Background())
+	if err != nil {
+		t.Fatalf("sampled out totals: %v", err)
+	}
+	if len(totals) != 1 || totals[0].Traces != 2 || totals[0].TotalTokens != 30 {
+		t.Fatalf("totals = %+v, want the sampled traces counted once", totals)
+	}
 }
@@ -28,8 +28,8 @@ func TestPushPipeline100Traces(t *testing.T) {
 
 	for i := 0; i < 100; i++ {
 		traceID := makeTraceID(i)
-		if err := dbm.InsertBatch(context.Background(),
-			[]db.TraceInsert{{
+		if _, err := dbm.InsertBatch(context.Background(), db.Batch{
+			Traces: []db.TraceInsert{{
 				TraceID:          traceID,
 				CreatedAt:        time.Now().UnixMilli() + int64(i),
 				Provider:         "anthropic",
@@ -41,9 +41,7 @@ func TestPushPipeline100Traces(t *testing.T) {
 				CompletionTokens: 21,
 				Status:           "ok",
 			}},
-			nil,
-			nil,
-		); err != nil {
+		}); err != nil {
 			t.Fatalf("seed trace insert %d: %v", i, err)
 		}
 	}
@@ -91,12 +89,12 @@ func TestPushPipeline100Traces(t *testing.T) {
 		t.Fatalf("receiver got %d events, want >=100", received)
 	}
 
-	traces, errs, metrics, err := dbm.PendingCounts(context.Background())
+	pending, err := dbm.PendingCounts(context.Background())
 	if err != nil {
 		t.Fatalf("pending counts: %v", err)
 	}
-	if traces != 0 || errs != 0 || metrics != 0 {
-		t.Fatalf("expected no pending rows after successful push, got t=%d e=%d m=%d", traces, errs, metrics)
+	if pending != (db.Pending{}) {
+		t.Fatalf("expected no pending rows after successful push, got %+v", pending)
 	}
 }
 
@@ -0,0 +1,153 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type jsonRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []jsonKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []jsonSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type jsonSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId"`
+	Name              string         `json:"name"`
+	StartTimeUnixNano jsonUint64     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   jsonUint64     `json:"endTimeUnixNano"`
+	Attributes        []jsonKeyValue `json:"attributes"`
+	Events            []struct {
+		Name         string         `json:"name"`
+		TimeUnixNano jsonUint64     `json:"timeUnixNano"`
+		Attributes   []jsonKeyValue `json:"attributes"`
+	} `json:"events"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type jsonKeyValue struct {
+	Key   string       `json:"key"`
+	Value jsonAnyValue `json:"value"`
+}
+
+type jsonAnyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    *jsonUint64 `json:"intValue"`
+	DoubleValue *float64    `json:"doubleValue"`
+	BytesValue  *string     `json:"bytesValue"`
+	ArrayValue  *struct {
+		Values []jsonAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []jsonKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+}
+
+// jsonUint64 accepts the string form that OTLP/JSON mandates for 64-bit
+// integers as well as plain JSON numbers.
+type jsonUint64 uint64
+
+func (v *jsonUint64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(bytes.TrimSpace(data)), `"`)
+	if s == "" || s == "null" {
+		*v = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		u, uerr := strconv.ParseUint(s, 10, 64)
+		if uerr != nil {
+			return err
+		}
+		*v = jsonUint64(u)
+		return nil
+	}
+	*v = jsonUint64(n)
+	return nil
+}
+
+// DecodeJSON parses an ExportTraceServiceRequest in OTLP/JSON encoding.
+func DecodeJSON(body []byte) ([]Span, error) {
+	var req jsonRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	var spans []Span
+	for _, rs := range req.ResourceSpans {
+		resource := jsonAttributes(rs.Resource.Attributes)
+		for _, ss := range rs.ScopeSpans {
+			for _, js := range ss.Spans {
+				span := Span{
+					TraceID:       strings.ToLower(js.TraceID),
+					SpanID:        strings.ToLower(js.SpanID),
+					ParentSpanID:  strings.ToLower(js.ParentSpanID),
+					Name:          js.Name,
+					StartUnixNano: uint64(js.StartTimeUnixNano),
+					EndUnixNano:   uint64(js.EndTimeUnixNano),
+					Attributes:    jsonAttributes(js.Attributes),
+					Resource:      resource,
+					StatusCode:    js.Status.Code,
+					StatusMessage: js.Status.Message,
+				}
+				for _, je := range js.Events {
+					span.Events = append(span.Events, SpanEvent{
+						Name:         je.Name,
+						TimeUnixNano: uint64(je.TimeUnixNano),
+						Attributes:   jsonAttributes(je.Attributes),
+					})
+				}
+				spans = append(spans, span)
+			}
+		}
+	}
+	return spans, nil
+}
+
+func jsonAttributes(kvs []jsonKeyValue) map[string]any {
+	out := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		if kv.Key == "" {
+			continue
+		}
+		out[kv.Key] = kv.Value.value()
+	}
+	return out
+}
+
+func (v jsonAnyValue) value() any {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	case v.ArrayValue != nil:
+		values := make([]any, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		return jsonAttributes(v.KvlistValue.Values)
+	}
+	return nil
+}
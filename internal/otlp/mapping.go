@@ -0,0 +1,241 @@
+package otlp
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+// ToEvents maps spans onto ingest events. Spans that carry a GenAI provider
+// and model become traces, execute_tool spans become tool calls, and
+// "exception" span events become error events regardless of whether the span
+// itself is a GenAI call.
+func ToEvents(spans []Span, now time.Time) []ingest.Event {
+	out := make([]ingest.Event, 0, len(spans))
+	for _, span := range spans {
+		meta := spanMetadata(span)
+		if trace, ok := traceFromSpan(span, meta); ok {
+			out = append(out, ingest.Event{
+				Kind:      ingest.EventKindTrace,
+				TraceID:   spanKey(span),
+				CreatedAt: unixNanoToMilli(span.StartUnixNano, now),
+				Trace:     trace,
+			})
+		} else if call, ok := toolCallFromSpan(span, meta); ok {
+			out = append(out, ingest.Event{
+				Kind:      ingest.EventKindToolCall,
+				TraceID:   spanKey(span),
+				CreatedAt: unixNanoToMilli(span.StartUnixNano, now),
+				ToolCall:  call,
+			})
+		}
+		for i, ev := range span.Events {
+			if ev.Name != "exception" {
+				continue
+			}
+			out = append(out, ingest.Event{
+				Kind:      ingest.EventKindError,
+				TraceID:   exceptionKey(span, i, ev),
+				CreatedAt: unixNanoToMilli(ev.TimeUnixNano, now),
+				Error:     errorFromException(ev, meta),
+			})
+		}
+	}
+	return out
+}
+
+func traceFromSpan(span Span, meta string) (*ingest.TracePayload, bool) {
+	attrs := span.Attributes
+	provider := firstString(attrs, "gen_ai.system", "gen_ai.provider.name")
+	model := firstString(attrs, "gen_ai.request.model", "gen_ai.response.model")
+	if provider == "" || model == "" {
+		return nil, false
+	}
+
+	prompt, _ := firstInt(attrs, "gen_ai.usage.input_tokens", "gen_ai.usage.prompt_tokens")
+	completion, _ := firstInt(attrs, "gen_ai.usage.output_tokens", "gen_ai.usage.completion_tokens")
+	total, ok := firstInt(attrs, "gen_ai.usage.total_tokens")
+	if !ok {
+		total = prompt + completion
+	}
+
+	status := "ok"
+	errorType := ""
+	if span.StatusCode == StatusCodeError {
+		status = "error"
+		errorType = firstString(attrs, "error.type")
+		if errorType == "" {
+			errorType = "span_error"
+		}
+	}
+
+	return &ingest.TracePayload{
+		Provider:         provider,
+		Model:            model,
+		InputText:        firstString(attrs, "gen_ai.prompt", "gen_ai.input.messages"),
+		OutputText:       firstString(attrs, "gen_ai.completion", "gen_ai.output.messages"),
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      total,
+		LatencyMS:        spanDurationMS(span),
+		Status:           status,
+		ErrorType:        errorType,
+		Metadata:         meta,
+		SessionID:        firstString(attrs, "gen_ai.conversation.id", "session.id"),
+		RunID:            span.TraceID,
+		SpanID:           span.SpanID,
+		ParentSpanID:     span.ParentSpanID,
+	}, true
+}
+
+// toolCallFromSpan maps a span following the GenAI execute_tool convention.
+// The result itself is not stored, only its size.
+func toolCallFromSpan(span Span, meta string) (*ingest.ToolCallPayload, bool) {
+	attrs := span.Attributes
+	if firstString(attrs, "gen_ai.operation.name") != "execute_tool" {
+		return nil, false
+	}
+	name := firstString(attrs, "gen_ai.tool.name")
+	if name == "" {
+		name = span.Name
+	}
+
+	status := "ok"
+	errorType := ""
+	if span.StatusCode == StatusCodeError {
+		status = "error"
+		errorType = firstString(attrs, "error.type")
+		if errorType == "" {
+			errorType = "span_error"
+		}
+	}
+
+	return &ingest.ToolCallPayload{
+		ToolName:     name,
+		Arguments:    firstString(attrs, "gen_ai.tool.call.arguments"),
+		ResultBytes:  int64(len(firstString(attrs, "gen_ai.tool.call.result"))),
+		DurationMS:   spanDurationMS(span),
+		Status:       status,
+		ErrorType:    errorType,
+		ErrorMessage: span.StatusMessage,
+		Metadata:     meta,
+		SessionID:    firstString(attrs, "gen_ai.conversation.id", "session.id"),
+		RunID:        span.TraceID,
+		SpanID:       span.SpanID,
+		ParentSpanID: span.ParentSpanID,
+		StartedAt:    nanoToMilli(span.StartUnixNano),
+		EndedAt:      nanoToMilli(span.EndUnixNano),
+	}, true
+}
+
+func errorFromException(ev SpanEvent, meta string) *ingest.ErrorPayload {
+	errorType := firstString(ev.Attributes, "exception.type")
+	if errorType == "" {
+		errorType = "exception"
+	}
+	message := firstString(ev.Attributes, "exception.message")
+	if message == "" {
+		message = errorType
+	}
+	return &ingest.ErrorPayload{
+		ErrorType:  errorType,
+		Message:    message,
+		StackTrace: firstString(ev.Attributes, "exception.stacktrace"),
+		Severity:   "error",
+		Metadata:   meta,
+	}
+}
+
+// spanKey derives a stable row key from the span identity so that exporter
+// retries of the same span are stored once.
+func spanKey(span Span) string {
+	if span.TraceID == "" || span.SpanID == "" {
+		return ""
+	}
+	return span.TraceID + "-" + span.SpanID
+}
+
+// exceptionKey is the row key of the i-th event of span, an exception, so a
+// retried export stores its error once too.
+func exceptionKey(span Span, i int, ev SpanEvent) string {
+	key := spanKey(span)
+	if key == "" {
+		return ""
+	}
+	return key + "-e" + strconv.Itoa(i) + "-" + strconv.FormatUint(ev.TimeUnixNano, 10)
+}
+
+func spanMetadata(span Span) string {
+	meta := map[string]any{
+		"source":        "otlp",
+		"otel_trace_id": span.TraceID,
+		"otel_span_id":  span.SpanID,
+		"span_name":     span.Name,
+	}
+	if op := firstString(span.Attributes, "gen_ai.operation.name"); op != "" {
+		meta["operation"] = op
+	}
+	if service := firstString(span.Resource, "service.name"); service != "" {
+		meta["service_name"] = service
+	}
+	if span.StatusMessage != "" {
+		meta["status_message"] = span.StatusMessage
+	}
+	raw, _ := json.Marshal(meta)
+	return string(raw)
+}
+
+func spanDurationMS(span Span) int {
+	if span.EndUnixNano > span.StartUnixNano && span.StartUnixNano > 0 {
+		return int((span.EndUnixNano - span.StartUnixNano) / uint64(time.Millisecond))
+	}
+	return 0
+}
+
+func nanoToMilli(ns uint64) int64 {
+	return int64(ns / uint64(time.Millisecond))
+}
+
+func unixNanoToMilli(ns uint64, now time.Time) int64 {
+	if ns == 0 {
+		return now.UnixMilli()
+	}
+	return int64(ns / uint64(time.Millisecond))
+}
+
+func firstString(attrs map[string]any, keys ...string) string {
+	for _, key := range keys {
+		switch v := attrs[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case []any:
+			// Array-valued attributes such as gen_ai.response.finish_reasons
+			// are stored as their JSON encoding.
+			raw, err := json.Marshal(v)
+			if err == nil {
+				return string(raw)
+			}
+		}
+	}
+	return ""
+}
+
+func firstInt(attrs map[string]any, keys ...string) (int, bool) {
+	for _, key := range keys {
+		switch v := attrs[key].(type) {
+		case int64:
+			return int(v), true
+		case float64:
+			return int(v), true
+		case string:
+			if n, err := strconv.Atoi(v); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
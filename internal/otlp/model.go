@@ -0,0 +1,27 @@
+package otlp
+
+// Span is the subset of an OTLP span needed to build trace and error events.
+// Identifiers are lowercase hex, timestamps are unix nanoseconds and attribute
+// values are string, bool, int64, float64, []any or map[string]any.
+type Span struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	StartUnixNano uint64
+	EndUnixNano   uint64
+	Attributes    map[string]any
+	Resource      map[string]any
+	Events        []SpanEvent
+	StatusCode    int
+	StatusMessage string
+}
+
+type SpanEvent struct {
+	Name         string
+	TimeUnixNano uint64
+	Attributes   map[string]any
+}
+
+// StatusCodeError mirrors STATUS_CODE_ERROR from the OTLP trace proto.
+const StatusCodeError = 2
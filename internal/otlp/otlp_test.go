@@ -0,0 +1,220 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+func pbBytes(num int, b []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(num<<3|wireBytes))
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+func pbString(num int, s string) []byte {
+	return pbBytes(num, []byte(s))
+}
+
+func pbVarint(num int, v uint64) []byte {
+	out := binary.AppendUvarint(nil, uint64(num<<3|wireVarint))
+	return binary.AppendUvarint(out, v)
+}
+
+func pbFixed64(num int, v uint64) []byte {
+	out := binary.AppendUvarint(nil, uint64(num<<3|wireFixed64))
+	return binary.LittleEndian.AppendUint64(out, v)
+}
+
+func pbKV(key string, value []byte) []byte {
+	return append(pbString(1, key), pbBytes(2, value)...)
+}
+
+func join(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestDecodeProtobufMapsGenAISpan(t *testing.T) {
+	t.Parallel()
+
+	start := uint64(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano())
+	end := start + uint64(1500*time.Millisecond)
+
+	exception := join(
+		pbFixed64(1, end),
+		pbString(2, "exception"),
+		pbBytes(3, pbKV("exception.type", pbString(1, "RateLimitError"))),
+		pbBytes(3, pbKV("exception.message", pbString(1, "429 too many requests"))),
+	)
+	span := join(
+		pbBytes(1, []byte{0x0a, 0xf7, 0x65, 0x1b}),
+		pbBytes(2, []byte{0x01, 0x02}),
+		pbString(5, "chat claude-sonnet-4"),
+		pbFixed64(7, start),
+		pbFixed64(8, end),
+		pbBytes(9, pbKV("gen_ai.system", pbString(1, "anthropic"))),
+		pbBytes(9, pbKV("gen_ai.request.model", pbString(1, "claude-sonnet-4"))),
+		pbBytes(9, pbKV("gen_ai.usage.input_tokens", pbVarint(3, 120))),
+		pbBytes(9, pbKV("gen_ai.usage.output_tokens", pbVarint(3, 30))),
+		pbBytes(9, pbKV("gen_ai.request.temperature", pbFixed64(4, math.Float64bits(0.2)))),
+		pbBytes(11, exception),
+		pbBytes(15, join(pbString(2, "rate limited"), pbVarint(3, StatusCodeError))),
+	)
+	resource := pbBytes(1, pbKV("service.name", pbString(1, "openclaw-agent")))
+	request := pbBytes(1, join(pbBytes(1, resource), pbBytes(2, pbBytes(2, span))))
+
+	spans, err := DecodeProtobuf(request)
+	if err != nil {
+		t.Fatalf("decode protobuf: %v", err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+	if spans[0].TraceID != "0af7651b" || spans[0].SpanID != "0102" {
+		t.Fatalf("unexpected ids: %+v", spans[0])
+	}
+	if spans[0].Attributes["gen_ai.request.temperature"] != 0.2 {
+		t.Fatalf("double attribute = %v", spans[0].Attributes["gen_ai.request.temperature"])
+	}
+
+	events := ToEvents(spans, time.Now())
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want trace + error", len(events))
+	}
+	trace := events[0].Trace
+	if events[0].Kind != ingest.EventKindTrace || trace == nil {
+		t.Fatalf("first event is not a trace: %+v", events[0])
+	}
+	if trace.Provider != "anthropic" || trace.Model != "claude-sonnet-4" {
+		t.Fatalf("unexpected provider/model: %+v", trace)
+	}
+	if trace.PromptTokens != 120 || trace.CompletionTokens != 30 || trace.TotalTokens != 150 {
+		t.Fatalf("unexpected token mapping: %+v", trace)
+	}
+	if trace.LatencyMS != 1500 || trace.Status != "error" {
+		t.Fatalf("unexpected latency/status: %+v", trace)
+	}
+	if events[0].CreatedAt != int64(start/uint64(time.Millisecond)) {
+		t.Fatalf("created_at = %d, want span start", events[0].CreatedAt)
+	}
+
+	errEv := events[1].Error
+	if events[1].Kind != ingest.EventKindError || errEv == nil {
+		t.Fatalf("second event is not an error: %+v", events[1])
+	}
+	if errEv.ErrorType != "RateLimitError" || errEv.Message != "429 too many requests" {
+		t.Fatalf("unexpected exception mapping: %+v", errEv)
+	}
+	if want := fmt.Sprintf("0af7651b-0102-e0-%d", end); events[1].TraceID != want {
+		t.Fatalf("error id = %q, want %q", events[1].TraceID, want)
+	}
+	if retried := ToEvents(spans, time.Now()); retried[1].TraceID != events[1].TraceID {
+		t.Fatalf("retried error id = %q, want %q", retried[1].TraceID, events[1].TraceID)
+	}
+}
+
+func TestDecodeProtobufRejectsTruncatedInput(t *testing.T) {
+	t.Parallel()
+
+	if _, err := DecodeProtobuf([]byte{0x0a, 0x10, 0x01}); err == nil {
+		t.Fatalf("expected error for truncated message")
+	}
+}
+
+func TestDecodeJSONMapsGenAISpan(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{
+  "resourceSpans": [{
+    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "tools"}}]},
+    "scopeSpans": [{
+      "spans": [
+        {
+          "traceId": "5B8EFFF798038103D269B633813FC60C",
+          "spanId": "EEE19B7EC3C1B174",
+          "name": "chat gpt-4o",
+          "startTimeUnixNano": "1700000000000000000",
+          "endTimeUnixNano": "1700000000250000000",
+          "attributes": [
+            {"key": "gen_ai.system", "value": {"stringValue": "openai"}},
+            {"key": "gen_ai.request.model", "value": {"stringValue": "gpt-4o"}},
+            {"key": "gen_ai.usage.input_tokens", "value": {"intValue": "10"}},
+            {"key": "gen_ai.usage.output_tokens", "value": {"intValue": 5}}
+          ],
+          "status": {}
+        },
+        {
+          "traceId": "5B8EFFF798038103D269B633813FC60C",
+          "spanId": "EEE19B7EC3C1B175",
+          "name": "http get",
+          "attributes": [{"key": "http.method", "value": {"stringValue": "GET"}}]
+        }
+      ]
+    }]
+  }]
+}`)
+
+	spans, err := DecodeJSON(body)
+	if err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+
+	events := ToEvents(spans, time.Now())
+	if len(events) != 1 {
+		t.Fatalf("events = %d, want only the genai span", len(events))
+	}
+	trace := events[0].Trace
+	if trace.Provider != "openai" || trace.Model != "gpt-4o" || trace.Status != "ok" {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	if trace.PromptTokens != 10 || trace.CompletionTokens != 5 || trace.LatencyMS != 250 {
+		t.Fatalf("unexpected usage/latency: %+v", trace)
+	}
+}
+
+func TestToEventsMapsExecuteToolSpan(t *testing.T) {
+	t.Parallel()
+
+	spans := []Span{{
+		TraceID:       "5b8efff798038103d269b633813fc60c",
+		SpanID:        "eee19b7ec3c1b176",
+		ParentSpanID:  "eee19b7ec3c1b174",
+		Name:          "execute_tool web_fetch",
+		StartUnixNano: 1_700_000_000_000_000_000,
+		EndUnixNano:   1_700_000_000_400_000_000,
+		Attributes: map[string]any{
+			"gen_ai.operation.name":      "execute_tool",
+			"gen_ai.tool.name":           "web_fetch",
+			"gen_ai.tool.call.arguments": `{"url":"https://example.com"}`,
+			"gen_ai.tool.call.result":    "<html></html>",
+		},
+		StatusCode:    StatusCodeError,
+		StatusMessage: "timeout",
+	}}
+
+	events := ToEvents(spans, time.Now())
+	if len(events) != 1 || events[0].Kind != ingest.EventKindToolCall {
+		t.Fatalf("events = %+v, want one tool call", events)
+	}
+	call := events[0].ToolCall
+	if call.ToolName != "web_fetch" || call.Arguments != `{"url":"https://example.com"}` || call.ResultBytes != 13 {
+		t.Fatalf("unexpected tool call: %+v", call)
+	}
+	if call.DurationMS != 400 || call.Status != "error" || call.ErrorMessage != "timeout" {
+		t.Fatalf("unexpected outcome: %+v", call)
+	}
+	if call.ParentSpanID != "eee19b7ec3c1b174" || events[0].TraceID != "5b8efff798038103d269b633813fc60c-eee19b7ec3c1b176" {
+		t.Fatalf("unexpected identity: %+v", events[0])
+	}
+}
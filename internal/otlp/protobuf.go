@@ -0,0 +1,277 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("protobuf: truncated message")
+
+// DecodeProtobuf parses an ExportTraceServiceRequest in protobuf encoding.
+// Only the fields used by the GenAI mapping are decoded; everything else is
+// skipped according to its wire type.
+func DecodeProtobuf(body []byte) ([]Span, error) {
+	var spans []Span
+	err := walkFields(body, func(num int, wt int, raw []byte, _ uint64) error {
+		if num != 1 || wt != wireBytes {
+			return nil
+		}
+		decoded, err := decodeResourceSpans(raw)
+		if err != nil {
+			return err
+		}
+		spans = append(spans, decoded...)
+		return nil
+	})
+	return spans, err
+}
+
+func decodeResourceSpans(buf []byte) ([]Span, error) {
+	var resource map[string]any
+	var scopeSpans [][]byte
+	err := walkFields(buf, func(num int, wt int, raw []byte, _ uint64) error {
+		if wt != wireBytes {
+			return nil
+		}
+		switch num {
+		case 1:
+			attrs, err := decodeResource(raw)
+			if err != nil {
+				return err
+			}
+			resource = attrs
+		case 2:
+			scopeSpans = append(scopeSpans, raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var spans []Span
+	for _, ss := range scopeSpans {
+		err := walkFields(ss, func(num int, wt int, raw []byte, _ uint64) error {
+			if num != 2 || wt != wireBytes {
+				return nil
+			}
+			span, err := decodeSpan(raw)
+			if err != nil {
+				return err
+			}
+			span.Resource = resource
+			spans = append(spans, span)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return spans, nil
+}
+
+func decodeResource(buf []byte) (map[string]any, error) {
+	attrs := map[string]any{}
+	err := walkFields(buf, func(num int, wt int, raw []byte, _ uint64) error {
+		if num != 1 || wt != wireBytes {
+			return nil
+		}
+		return decodeKeyValueInto(raw, attrs)
+	})
+	return attrs, err
+}
+
+func decodeSpan(buf []byte) (Span, error) {
+	span := Span{Attributes: map[string]any{}}
+	err := walkFields(buf, func(num int, wt int, raw []byte, scalar uint64) error {
+		switch {
+		case num == 1 && wt == wireBytes:
+			span.TraceID = hex.EncodeToString(raw)
+		case num == 2 && wt == wireBytes:
+			span.SpanID = hex.EncodeToString(raw)
+		case num == 4 && wt == wireBytes:
+			span.ParentSpanID = hex.EncodeToString(raw)
+		case num == 5 && wt == wireBytes:
+			span.Name = string(raw)
+		case num == 7 && wt == wireFixed64:
+			span.StartUnixNano = scalar
+		case num == 8 && wt == wireFixed64:
+			span.EndUnixNano = scalar
+		case num == 9 && wt == wireBytes:
+			return decodeKeyValueInto(raw, span.Attributes)
+		case num == 11 && wt == wireBytes:
+			ev, err := decodeSpanEvent(raw)
+			if err != nil {
+				return err
+			}
+			span.Events = append(span.Events, ev)
+		case num == 15 && wt == wireBytes:
+			return walkFields(raw, func(num int, wt int, raw []byte, scalar uint64) error {
+				switch {
+				case num == 2 && wt == wireBytes:
+					span.StatusMessage = string(raw)
+				case num == 3 && wt == wireVarint:
+					span.StatusCode = int(scalar)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return span, err
+}
+
+func decodeSpanEvent(buf []byte) (SpanEvent, error) {
+	ev := SpanEvent{Attributes: map[string]any{}}
+	err := walkFields(buf, func(num int, wt int, raw []byte, scalar uint64) error {
+		switch {
+		case num == 1 && wt == wireFixed64:
+			ev.TimeUnixNano = scalar
+		case num == 2 && wt == wireBytes:
+			ev.Name = string(raw)
+		case num == 3 && wt == wireBytes:
+			return decodeKeyValueInto(raw, ev.Attributes)
+		}
+		return nil
+	})
+	return ev, err
+}
+
+func decodeKeyValueInto(buf []byte, out map[string]any) error {
+	var key string
+	var value any
+	err := walkFields(buf, func(num int, wt int, raw []byte, _ uint64) error {
+		if wt != wireBytes {
+			return nil
+		}
+		switch num {
+		case 1:
+			key = string(raw)
+		case 2:
+			v, err := decodeAnyValue(raw)
+			if err != nil {
+				return err
+			}
+			value = v
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		out[key] = value
+	}
+	return nil
+}
+
+func decodeAnyValue(buf []byte) (any, error) {
+	var value any
+	err := walkFields(buf, func(num int, wt int, raw []byte, scalar uint64) error {
+		switch {
+		case num == 1 && wt == wireBytes:
+			value = string(raw)
+		case num == 2 && wt == wireVarint:
+			value = scalar != 0
+		case num == 3 && wt == wireVarint:
+			value = int64(scalar)
+		case num == 4 && wt == wireFixed64:
+			value = math.Float64frombits(scalar)
+		case num == 5 && wt == wireBytes:
+			var values []any
+			err := walkFields(raw, func(num int, wt int, raw []byte, _ uint64) error {
+				if num != 1 || wt != wireBytes {
+					return nil
+				}
+				v, err := decodeAnyValue(raw)
+				if err != nil {
+					return err
+				}
+				values = append(values, v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			value = values
+		case num == 6 && wt == wireBytes:
+			kv := map[string]any{}
+			err := walkFields(raw, func(num int, wt int, raw []byte, _ uint64) error {
+				if num != 1 || wt != wireBytes {
+					return nil
+				}
+				return decodeKeyValueInto(raw, kv)
+			})
+			if err != nil {
+				return err
+			}
+			value = kv
+		case num == 7 && wt == wireBytes:
+			value = hex.EncodeToString(raw)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// walkFields calls fn for every field in buf. Length-delimited fields are
+// passed as raw bytes; varint and fixed-width fields as scalar.
+func walkFields(buf []byte, fn func(num int, wt int, raw []byte, scalar uint64) error) error {
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errTruncated
+		}
+		buf = buf[n:]
+		num := int(tag >> 3)
+		wt := int(tag & 0x7)
+
+		var raw []byte
+		var scalar uint64
+		switch wt {
+		case wireVarint:
+			v, n := binary.Uvarint(buf)
+			if n <= 0 {
+				return errTruncated
+			}
+			scalar = v
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errTruncated
+			}
+			scalar = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errTruncated
+			}
+			scalar = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(buf)
+			if n <= 0 || l > uint64(len(buf)-n) {
+				return errTruncated
+			}
+			raw = buf[n : n+int(l)]
+			buf = buf[n+int(l):]
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", wt)
+		}
+		if err := fn(num, wt, raw, scalar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type anthropicRequest struct {
+	Model    string          `json:"model"`
+	System   json.RawMessage `json:"system"`
+	Messages json.RawMessage `json:"messages"`
+}
+
+type anthropicResponse struct {
+	errorBody
+	Type       string `json:"type"`
+	Model      string `json:"model"`
+	StopReason string `json:"stop_reason"`
+	Content    []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		ID    string          `json:"id"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// apply copies usage into out. Anthropic reports cache reads and writes
+// separately from input_tokens; they are added back so PromptTokens covers
+// all input.
+func (u anthropicUsage) apply(out *Extraction) {
+	out.PromptTokens = u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	out.CompletionTokens = u.OutputTokens
+	out.TotalTokens = out.PromptTokens + out.CompletionTokens
+	out.CachedTokens = u.CacheReadInputTokens
+	out.CacheWriteTokens = u.CacheCreationInputTokens
+}
+
+func extractAnthropic(request, response []byte) (Extraction, error) {
+	var req anthropicRequest
+	if err := decodeBody(request, &req, "anthropic request"); err != nil {
+		return Extraction{}, err
+	}
+	var resp anthropicResponse
+	if err := decodeBody(response, &resp, "anthropic response"); err != nil {
+		return Extraction{}, err
+	}
+
+	out := Extraction{
+		Model:      firstNonEmpty(resp.Model, req.Model),
+		InputText:  compactJSON(req.Messages),
+		StopReason: resp.StopReason,
+	}
+	resp.Usage.apply(&out)
+
+	var text []string
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use", "server_tool_use":
+			out.ToolCalls = append(out.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: compactJSON(block.Input)})
+		}
+	}
+	out.OutputText = strings.Join(text, "\n")
+
+	if resp.Error != nil {
+		out.ErrorType = resp.errorType()
+		out.ErrorMessage = resp.Error.Message
+	} else if resp.StopReason == "refusal" {
+		out.ErrorType = "refusal"
+	}
+	return out, nil
+}
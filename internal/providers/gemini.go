@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type geminiRequest struct {
+	Model    string          `json:"model"`
+	Contents json.RawMessage `json:"contents"`
+}
+
+type geminiResponse struct {
+	errorBody
+	ModelVersion string `json:"modelVersion"`
+	Candidates   []struct {
+		FinishReason string `json:"finishReason"`
+		Content      struct {
+			Parts []struct {
+				Text         string `json:"text"`
+				Thought      bool   `json:"thought"`
+				FunctionCall *struct {
+					ID   string          `json:"id"`
+					Name string          `json:"name"`
+					Args json.RawMessage `json:"args"`
+				} `json:"functionCall"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func extractGemini(request, response []byte) (Extraction, error) {
+	var req geminiRequest
+	if err := decodeBody(request, &req, "gemini request"); err != nil {
+		return Extraction{}, err
+	}
+	var resp geminiResponse
+	if err := decodeBody(response, &resp, "gemini response"); err != nil {
+		return Extraction{}, err
+	}
+
+	// Gemini leaves thinking tokens out of candidatesTokenCount; they are
+	// billed as output, so they are added to CompletionTokens.
+	u := resp.UsageMetadata
+	out := Extraction{
+		Model:            firstNonEmpty(resp.ModelVersion, strings.TrimPrefix(req.Model, "models/")),
+		InputText:        compactJSON(req.Contents),
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+		CachedTokens:     u.CachedContentTokenCount,
+		ReasoningTokens:  u.ThoughtsTokenCount,
+	}
+
+	var text []string
+	for i, candidate := range resp.Candidates {
+		if i == 0 {
+			out.StopReason = candidate.FinishReason
+		}
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil {
+				out.ToolCalls = append(out.ToolCalls, ToolCall{
+					ID:        part.FunctionCall.ID,
+					Name:      part.FunctionCall.Name,
+					Arguments: compactJSON(part.FunctionCall.Args),
+				})
+				continue
+			}
+			if part.Text != "" && !part.Thought {
+				text = append(text, part.Text)
+			}
+		}
+	}
+	out.OutputText = strings.Join(text, "\n")
+
+	switch {
+	case resp.Error != nil:
+		out.ErrorType = resp.errorType()
+		out.ErrorMessage = resp.Error.Message
+	case resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "":
+		out.ErrorType = "prompt_blocked"
+		out.StopReason = resp.PromptFeedback.BlockReason
+	case out.StopReason == "SAFETY" || out.StopReason == "RECITATION" || out.StopReason == "PROHIBITED_CONTENT":
+		out.ErrorType = "content_blocked"
+	}
+	return out, nil
+}
@@ -0,0 +1,163 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type openAIRequest struct {
+	Model        string          `json:"model"`
+	Messages     json.RawMessage `json:"messages"`
+	Input        json.RawMessage `json:"input"`
+	Instructions string          `json:"instructions"`
+}
+
+// openAIResponse covers both the Chat Completions ("chat.completion") and
+// the Responses ("response") API shapes.
+type openAIResponse struct {
+	errorBody
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	Status string `json:"status"`
+
+	Choices []struct {
+		FinishReason string `json:"finish_reason"`
+		Message      struct {
+			Content   *string `json:"content"`
+			Refusal   *string `json:"refusal"`
+			ToolCalls []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+
+	Output []struct {
+		Type      string `json:"type"`
+		CallID    string `json:"call_id"`
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+		Content   []struct {
+			Type    string `json:"type"`
+			Text    string `json:"text"`
+			Refusal string `json:"refusal"`
+		} `json:"content"`
+	} `json:"output"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+
+	Usage openAIUsage `json:"usage"`
+}
+
+type openAIUsage struct {
+	// Chat Completions names.
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+
+	// Responses names.
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+
+	TotalTokens int `json:"total_tokens"`
+}
+
+// apply copies usage into out. OpenAI counts cached input inside the prompt
+// total and reasoning inside the completion total, which is already the
+// normalized form.
+func (u openAIUsage) apply(out *Extraction) {
+	out.PromptTokens = max(u.PromptTokens, u.InputTokens)
+	out.CompletionTokens = max(u.CompletionTokens, u.OutputTokens)
+	out.TotalTokens = u.TotalTokens
+	out.CachedTokens = max(u.PromptTokensDetails.CachedTokens, u.InputTokensDetails.CachedTokens)
+	out.ReasoningTokens = max(u.CompletionTokensDetails.ReasoningTokens, u.OutputTokensDetails.ReasoningTokens)
+}
+
+func extractOpenAI(request, response []byte) (Extraction, error) {
+	var req openAIRequest
+	if err := decodeBody(request, &req, "openai request"); err != nil {
+		return Extraction{}, err
+	}
+	var resp openAIResponse
+	if err := decodeBody(response, &resp, "openai response"); err != nil {
+		return Extraction{}, err
+	}
+
+	out := Extraction{
+		Model:     firstNonEmpty(resp.Model, req.Model),
+		InputText: compactJSON(req.Messages),
+	}
+	if out.InputText == "" {
+		out.InputText = compactJSON(req.Input)
+	}
+	if req.Instructions != "" && out.InputText == "" {
+		out.InputText = req.Instructions
+	}
+
+	resp.Usage.apply(&out)
+
+	var text []string
+	if resp.Object == "response" || len(resp.Output) > 0 {
+		out.StopReason = resp.Status
+		if resp.IncompleteDetails != nil && resp.IncompleteDetails.Reason != "" {
+			out.StopReason = resp.IncompleteDetails.Reason
+		}
+		for _, item := range resp.Output {
+			switch item.Type {
+			case "message":
+				for _, c := range item.Content {
+					text = append(text, firstNonEmpty(c.Text, c.Refusal))
+				}
+			case "function_call":
+				out.ToolCalls = append(out.ToolCalls, ToolCall{ID: item.CallID, Name: item.Name, Arguments: item.Arguments})
+			}
+		}
+	} else {
+		for _, choice := range resp.Choices {
+			if out.StopReason == "" {
+				out.StopReason = choice.FinishReason
+			}
+			if choice.Message.Content != nil {
+				text = append(text, *choice.Message.Content)
+			} else if choice.Message.Refusal != nil {
+				text = append(text, *choice.Message.Refusal)
+			}
+			for _, call := range choice.Message.ToolCalls {
+				out.ToolCalls = append(out.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+			}
+		}
+	}
+	out.OutputText = strings.Join(text, "\n")
+
+	if resp.Error != nil {
+		out.ErrorType = resp.errorType()
+		out.ErrorMessage = resp.Error.Message
+	} else if resp.Status == "failed" {
+		out.ErrorType = "response_failed"
+	}
+	return out, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
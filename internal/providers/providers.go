@@ -0,0 +1,148 @@
+// Package providers extracts trace fields from raw LLM provider request and
+// response bodies, so agents can forward what the provider returned instead
+// of mapping usage blocks themselves.
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ToolCall is a tool invocation requested by the model in its response.
+type ToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// Extraction holds the fields read from one provider exchange. Token counts
+// are normalized across providers: PromptTokens includes cached input and
+// CompletionTokens includes reasoning output, matching what is billed.
+type Extraction struct {
+	Model            string
+	InputText        string
+	OutputText       string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CachedTokens     int
+	CacheWriteTokens int
+	ReasoningTokens  int
+	StopReason       string
+	ToolCalls        []ToolCall
+	ErrorType        string
+	ErrorMessage     string
+}
+
+// Extractor reads a provider request and response. Either body may be empty.
+type Extractor func(request, response []byte) (Extraction, error)
+
+var extractors = map[string]Extractor{
+	"openai":    extractOpenAI,
+	"anthropic": extractAnthropic,
+	"gemini":    extractGemini,
+}
+
+// Names returns the supported provider hints.
+func Names() []string {
+	names := make([]string, 0, len(extractors))
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Extract runs the extractor for provider.
+func Extract(provider string, request, response []byte) (Extraction, error) {
+	extract, ok := extractors[strings.ToLower(provider)]
+	if !ok {
+		return Extraction{}, fmt.Errorf("unsupported provider %q (supported: %s)", provider, strings.Join(Names(), ", "))
+	}
+	return extract(request, response)
+}
+
+// Details returns the extracted fields that have no trace column, for
+// storage in metadata.
+func (e Extraction) Details() map[string]any {
+	out := map[string]any{}
+	if e.CachedTokens > 0 {
+		out["cached_tokens"] = e.CachedTokens
+	}
+	if e.CacheWriteTokens > 0 {
+		out["cache_write_tokens"] = e.CacheWriteTokens
+	}
+	if e.ReasoningTokens > 0 {
+		out["reasoning_tokens"] = e.ReasoningTokens
+	}
+	if e.StopReason != "" {
+		out["stop_reason"] = e.StopReason
+	}
+	if len(e.ToolCalls) > 0 {
+		out["tool_calls"] = e.ToolCalls
+	}
+	if e.ErrorMessage != "" {
+		out["error_message"] = e.ErrorMessage
+	}
+	return out
+}
+
+// decodeBody decodes an optional JSON body; an empty body leaves dst as is.
+func decodeBody(body []byte, dst any, what string) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		return fmt.Errorf("decode %s: %w", what, err)
+	}
+	return nil
+}
+
+// compactJSON returns raw without insignificant whitespace, or "" when raw is
+// absent.
+func compactJSON(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, trimmed); err != nil {
+		return string(trimmed)
+	}
+	return buf.String()
+}
+
+// errorBody is the {"error": {...}} envelope shared by all three providers,
+// with provider-specific names for the classification field.
+type errorBody struct {
+	Error *struct {
+		Type    string          `json:"type"`
+		Code    json.RawMessage `json:"code"`
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+	} `json:"error"`
+}
+
+// errorType picks the most specific classification available.
+func (e errorBody) errorType() string {
+	if e.Error == nil {
+		return ""
+	}
+	var code string
+	if err := json.Unmarshal(e.Error.Code, &code); err == nil && code != "" {
+		return code
+	}
+	if e.Error.Status != "" {
+		return e.Error.Status
+	}
+	if e.Error.Type != "" {
+		return e.Error.Type
+	}
+	if len(e.Error.Code) > 0 && string(e.Error.Code) != "null" {
+		return "http_" + string(e.Error.Code)
+	}
+	return "provider_error"
+}
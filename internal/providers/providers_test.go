@@ -0,0 +1,166 @@
+package providers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractOpenAIChatCompletion(t *testing.T) {
+	t.Parallel()
+
+	req := `{"model":"gpt-4o","messages":[{"role":"user","content":"weather?"}]}`
+	resp := `{
+		"object": "chat.completion",
+		"model": "gpt-4o-2024-08-06",
+		"choices": [{
+			"finish_reason": "tool_calls",
+			"message": {"content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+			]}
+		}],
+		"usage": {
+			"prompt_tokens": 120, "completion_tokens": 30, "total_tokens": 150,
+			"prompt_tokens_details": {"cached_tokens": 64},
+			"completion_tokens_details": {"reasoning_tokens": 10}
+		}
+	}`
+	got, err := Extract("OpenAI", []byte(req), []byte(resp))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	want := Extraction{
+		Model:            "gpt-4o-2024-08-06",
+		InputText:        `[{"role":"user","content":"weather?"}]`,
+		PromptTokens:     120,
+		CompletionTokens: 30,
+		TotalTokens:      150,
+		CachedTokens:     64,
+		ReasoningTokens:  10,
+		StopReason:       "tool_calls",
+		ToolCalls:        []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("extraction = %+v, want %+v", got, want)
+	}
+}
+
+func TestExtractOpenAIResponses(t *testing.T) {
+	t.Parallel()
+
+	resp := `{
+		"object": "response", "model": "gpt-4.1", "status": "completed",
+		"output": [
+			{"type": "reasoning", "summary": []},
+			{"type": "message", "content": [{"type": "output_text", "text": "Hello"}]},
+			{"type": "function_call", "call_id": "fc_1", "name": "lookup", "arguments": "{}"}
+		],
+		"usage": {"input_tokens": 12, "output_tokens": 8, "total_tokens": 20, "input_tokens_details": {"cached_tokens": 4}}
+	}`
+	got, err := Extract("openai", []byte(`{"input":"hi"}`), []byte(resp))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got.Model != "gpt-4.1" || got.InputText != `"hi"` || got.OutputText != "Hello" || got.StopReason != "completed" {
+		t.Fatalf("unexpected extraction: %+v", got)
+	}
+	if got.PromptTokens != 12 || got.CompletionTokens != 8 || got.TotalTokens != 20 || got.CachedTokens != 4 {
+		t.Fatalf("unexpected usage: %+v", got)
+	}
+	if len(got.ToolCalls) != 1 || got.ToolCalls[0].Name != "lookup" {
+		t.Fatalf("tool calls = %+v", got.ToolCalls)
+	}
+}
+
+func TestExtractAnthropicNormalizesCacheTokens(t *testing.T) {
+	t.Parallel()
+
+	resp := `{
+		"type": "message", "model": "claude-sonnet-4-5", "stop_reason": "tool_use",
+		"content": [
+			{"type": "text", "text": "Checking."},
+			{"type": "tool_use", "id": "toolu_1", "name": "search", "input": {"q": "go"}}
+		],
+		"usage": {"input_tokens": 10, "output_tokens": 20, "cache_creation_input_tokens": 100, "cache_read_input_tokens": 300}
+	}`
+	got, err := Extract("anthropic", nil, []byte(resp))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got.PromptTokens != 410 || got.CompletionTokens != 20 || got.TotalTokens != 430 {
+		t.Fatalf("unexpected usage: %+v", got)
+	}
+	if got.CachedTokens != 300 || got.CacheWriteTokens != 100 {
+		t.Fatalf("unexpected cache usage: %+v", got)
+	}
+	if got.OutputText != "Checking." || got.StopReason != "tool_use" {
+		t.Fatalf("unexpected output: %+v", got)
+	}
+	if len(got.ToolCalls) != 1 || got.ToolCalls[0].Arguments != `{"q":"go"}` {
+		t.Fatalf("tool calls = %+v", got.ToolCalls)
+	}
+}
+
+func TestExtractGeminiCountsThoughtsAsCompletion(t *testing.T) {
+	t.Parallel()
+
+	resp := `{
+		"modelVersion": "gemini-2.5-pro",
+		"candidates": [{
+			"finishReason": "STOP",
+			"content": {"parts": [
+				{"text": "thinking...", "thought": true},
+				{"text": "Answer"},
+				{"functionCall": {"name": "fetch", "args": {"url": "x"}}}
+			]}
+		}],
+		"usageMetadata": {"promptTokenCount": 50, "candidatesTokenCount": 10, "thoughtsTokenCount": 40, "totalTokenCount": 100, "cachedContentTokenCount": 20}
+	}`
+	got, err := Extract("gemini", []byte(`{"contents":[{"parts":[{"text":"q"}]}]}`), []byte(resp))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got.Model != "gemini-2.5-pro" || got.OutputText != "Answer" || got.StopReason != "STOP" {
+		t.Fatalf("unexpected extraction: %+v", got)
+	}
+	if got.PromptTokens != 50 || got.CompletionTokens != 50 || got.TotalTokens != 100 || got.ReasoningTokens != 40 || got.CachedTokens != 20 {
+		t.Fatalf("unexpected usage: %+v", got)
+	}
+	if len(got.ToolCalls) != 1 || got.ToolCalls[0].Name != "fetch" {
+		t.Fatalf("tool calls = %+v", got.ToolCalls)
+	}
+}
+
+func TestExtractErrorEnvelopes(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		provider string
+		response string
+		wantType string
+	}{
+		{"openai", `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, "rate_limit_exceeded"},
+		{"anthropic", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, "overloaded_error"},
+		{"gemini", `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, "RESOURCE_EXHAUSTED"},
+		{"gemini", `{"error":{"code":500,"message":"boom"}}`, "http_500"},
+	}
+	for _, tc := range cases {
+		got, err := Extract(tc.provider, nil, []byte(tc.response))
+		if err != nil {
+			t.Fatalf("%s: extract: %v", tc.provider, err)
+		}
+		if got.ErrorType != tc.wantType || got.ErrorMessage == "" {
+			t.Fatalf("%s: error = %q/%q, want type %q", tc.provider, got.ErrorType, got.ErrorMessage, tc.wantType)
+		}
+	}
+}
+
+func TestExtractRejectsUnknownProviderAndBadJSON(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Extract("cohere", nil, nil); err == nil {
+		t.Fatal("expected error for unsupported provider")
+	}
+	if _, err := Extract("openai", nil, []byte(`{"choices":`)); err == nil {
+		t.Fatal("expected error for malformed response")
+	}
+}
@@ -0,0 +1,270 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// maxStreamTextBytes bounds the output text an accumulator holds; the rest of
+// a long stream is still counted through usage but not kept.
+const maxStreamTextBytes = 1 << 20
+
+// StreamAccumulator builds an Extraction from a server-sent event stream. Add
+// is called with the data of each event in order; events that do not parse
+// are ignored so one bad chunk does not lose the call.
+type StreamAccumulator struct {
+	provider string
+	request  []byte
+	out      Extraction
+	text     strings.Builder
+	calls    []ToolCall
+	// callIndex maps the provider's tool call or content block index to its
+	// position in calls.
+	callIndex map[int]int
+
+	anthropicUsage anthropicUsage
+	// openAIFinal is the last full response object seen on a Responses API
+	// stream.
+	openAIFinal json.RawMessage
+}
+
+// NewStreamAccumulator starts an accumulator with the fields that can be read
+// from the request body.
+func NewStreamAccumulator(provider string, request []byte) (*StreamAccumulator, error) {
+	provider = strings.ToLower(provider)
+	out, err := Extract(provider, request, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamAccumulator{provider: provider, request: request, out: out, callIndex: map[int]int{}}, nil
+}
+
+// Add consumes the data of one event.
+func (a *StreamAccumulator) Add(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+	switch a.provider {
+	case "openai":
+		a.addOpenAI(data)
+	case "anthropic":
+		a.addAnthropic(data)
+	case "gemini":
+		a.addGemini(data)
+	}
+}
+
+// Result returns what has been accumulated so far.
+func (a *StreamAccumulator) Result() Extraction {
+	out := a.out
+	if a.openAIFinal != nil {
+		if final, err := extractOpenAI(a.request, a.openAIFinal); err == nil {
+			final.InputText = firstNonEmpty(final.InputText, out.InputText)
+			out = final
+		}
+	}
+	if a.provider == "anthropic" {
+		a.anthropicUsage.apply(&out)
+	}
+	if out.OutputText == "" {
+		out.OutputText = a.text.String()
+	}
+	if len(out.ToolCalls) == 0 && len(a.calls) > 0 {
+		out.ToolCalls = append([]ToolCall(nil), a.calls...)
+	}
+	if out.TotalTokens == 0 {
+		out.TotalTokens = out.PromptTokens + out.CompletionTokens
+	}
+	return out
+}
+
+func (a *StreamAccumulator) appendText(s string) {
+	if a.text.Len()+len(s) > maxStreamTextBytes {
+		return
+	}
+	a.text.WriteString(s)
+}
+
+// appendCallArguments adds an argument fragment to the call at index,
+// creating the call when the fragment is the first seen for it.
+func (a *StreamAccumulator) appendCallArguments(index int, call ToolCall) {
+	pos, ok := a.callIndex[index]
+	if !ok {
+		a.callIndex[index] = len(a.calls)
+		a.calls = append(a.calls, call)
+		return
+	}
+	existing := &a.calls[pos]
+	if existing.ID == "" {
+		existing.ID = call.ID
+	}
+	if existing.Name == "" {
+		existing.Name = call.Name
+	}
+	existing.Arguments += call.Arguments
+}
+
+type openAIChunk struct {
+	errorBody
+	Type     string          `json:"type"`
+	Model    string          `json:"model"`
+	Response json.RawMessage `json:"response"`
+	Delta    string          `json:"delta"`
+	Choices  []struct {
+		FinishReason string `json:"finish_reason"`
+		Delta        struct {
+			Content   string `json:"content"`
+			Refusal   string `json:"refusal"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// addOpenAI handles Chat Completions chunks and Responses API events. Chat
+// streams only carry usage when the client sets stream_options.include_usage.
+func (a *StreamAccumulator) addOpenAI(data []byte) {
+	var chunk openAIChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return
+	}
+	if chunk.Error != nil {
+		a.out.ErrorType = chunk.errorType()
+		a.out.ErrorMessage = chunk.Error.Message
+		return
+	}
+	if strings.HasPrefix(chunk.Type, "response.") {
+		if len(chunk.Response) > 0 {
+			a.openAIFinal = chunk.Response
+		}
+		if chunk.Type == "response.output_text.delta" {
+			a.appendText(chunk.Delta)
+		}
+		return
+	}
+
+	if chunk.Model != "" {
+		a.out.Model = chunk.Model
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != "" {
+			a.out.StopReason = choice.FinishReason
+		}
+		a.appendText(choice.Delta.Content)
+		a.appendText(choice.Delta.Refusal)
+		for _, call := range choice.Delta.ToolCalls {
+			a.appendCallArguments(call.Index, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+		}
+	}
+	if chunk.Usage != nil {
+		chunk.Usage.apply(&a.out)
+	}
+}
+
+type anthropicEvent struct {
+	errorBody
+	Type    string `json:"type"`
+	Message *struct {
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Index        int `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+}
+
+func (a *StreamAccumulator) addAnthropic(data []byte) {
+	var ev anthropicEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return
+	}
+	switch ev.Type {
+	case "message_start":
+		if ev.Message != nil {
+			a.out.Model = firstNonEmpty(ev.Message.Model, a.out.Model)
+			a.anthropicUsage = ev.Message.Usage
+		}
+	case "content_block_start":
+		if ev.ContentBlock.Type == "tool_use" || ev.ContentBlock.Type == "server_tool_use" {
+			a.appendCallArguments(ev.Index, ToolCall{ID: ev.ContentBlock.ID, Name: ev.ContentBlock.Name})
+		}
+	case "content_block_delta":
+		switch ev.Delta.Type {
+		case "text_delta":
+			a.appendText(ev.Delta.Text)
+		case "input_json_delta":
+			a.appendCallArguments(ev.Index, ToolCall{Arguments: ev.Delta.PartialJSON})
+		}
+	case "message_delta":
+		if ev.Delta.StopReason != "" {
+			a.out.StopReason = ev.Delta.StopReason
+			if ev.Delta.StopReason == "refusal" {
+				a.out.ErrorType = "refusal"
+			}
+		}
+		// message_delta usage is cumulative; input fields appear only when
+		// they changed since message_start.
+		if u := ev.Usage; u != nil {
+			a.anthropicUsage.OutputTokens = u.OutputTokens
+			if u.InputTokens > 0 {
+				a.anthropicUsage.InputTokens = u.InputTokens
+			}
+			if u.CacheReadInputTokens > 0 {
+				a.anthropicUsage.CacheReadInputTokens = u.CacheReadInputTokens
+			}
+			if u.CacheCreationInputTokens > 0 {
+				a.anthropicUsage.CacheCreationInputTokens = u.CacheCreationInputTokens
+			}
+		}
+	case "error":
+		if ev.Error != nil {
+			a.out.ErrorType = ev.errorType()
+			a.out.ErrorMessage = ev.Error.Message
+		}
+	}
+}
+
+// addGemini merges one streamGenerateContent chunk. Each chunk is a partial
+// response whose usage totals supersede the previous chunk's.
+func (a *StreamAccumulator) addGemini(data []byte) {
+	chunk, err := extractGemini(nil, data)
+	if err != nil {
+		return
+	}
+	a.out.Model = firstNonEmpty(chunk.Model, a.out.Model)
+	a.out.StopReason = firstNonEmpty(chunk.StopReason, a.out.StopReason)
+	a.appendText(chunk.OutputText)
+	for _, call := range chunk.ToolCalls {
+		a.appendCallArguments(len(a.calls), call)
+	}
+	if chunk.TotalTokens > 0 || chunk.PromptTokens > 0 {
+		a.out.PromptTokens = chunk.PromptTokens
+		a.out.CompletionTokens = chunk.CompletionTokens
+		a.out.TotalTokens = chunk.TotalTokens
+		a.out.CachedTokens = chunk.CachedTokens
+		a.out.ReasoningTokens = chunk.ReasoningTokens
+	}
+	if chunk.ErrorType != "" {
+		a.out.ErrorType = chunk.ErrorType
+		a.out.ErrorMessage = chunk.ErrorMessage
+	}
+}
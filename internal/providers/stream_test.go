@@ -0,0 +1,54 @@
+package providers
+
+import "testing"
+
+func TestStreamAccumulatorOpenAIChatAssemblesToolCalls(t *testing.T) {
+	t.Parallel()
+
+	acc, err := NewStreamAccumulator("openai", []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"go"}]}`))
+	if err != nil {
+		t.Fatalf("new accumulator: %v", err)
+	}
+	for _, data := range []string{
+		`{"model":"gpt-4o-2024-08-06","choices":[{"delta":{"role":"assistant","content":""}}]}`,
+		`{"choices":[{"delta":{"content":"On it"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"search","arguments":"{\"q\":"}}]}}]}`,
+		`not json`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go\"}"}}]}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":5,"total_tokens":25}}`,
+		`[DONE]`,
+	} {
+		acc.Add([]byte(data))
+	}
+
+	got := acc.Result()
+	if got.Model != "gpt-4o-2024-08-06" || got.OutputText != "On it" || got.StopReason != "tool_calls" {
+		t.Fatalf("unexpected extraction: %+v", got)
+	}
+	if got.PromptTokens != 20 || got.CompletionTokens != 5 || got.TotalTokens != 25 {
+		t.Fatalf("unexpected usage: %+v", got)
+	}
+	if len(got.ToolCalls) != 1 || got.ToolCalls[0].ID != "call_1" || got.ToolCalls[0].Arguments != `{"q":"go"}` {
+		t.Fatalf("tool calls = %+v", got.ToolCalls)
+	}
+}
+
+func TestStreamAccumulatorGeminiKeepsLatestUsage(t *testing.T) {
+	t.Parallel()
+
+	acc, err := NewStreamAccumulator("gemini", nil)
+	if err != nil {
+		t.Fatalf("new accumulator: %v", err)
+	}
+	acc.Add([]byte(`{"candidates":[{"content":{"parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":4,"totalTokenCount":4},"modelVersion":"gemini-2.5-flash"}`))
+	acc.Add([]byte(`{"candidates":[{"content":{"parts":[{"text":"lo"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`))
+
+	got := acc.Result()
+	if got.OutputText != "Hello" || got.StopReason != "STOP" || got.Model != "gemini-2.5-flash" {
+		t.Fatalf("unexpected extraction: %+v", got)
+	}
+	if got.PromptTokens != 4 || got.CompletionTokens != 2 || got.TotalTokens != 6 {
+		t.Fatalf("unexpected usage: %+v", got)
+	}
+}
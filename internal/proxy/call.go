@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+	"github.com/kon-rad/openclaw-trace/internal/providers"
+)
+
+// call is one proxied request on its way through the reverse proxy.
+type call struct {
+	proxy    *Proxy
+	provider string
+	upstream *url.URL
+	path     string
+	request  []byte
+	traced   bool
+	started  time.Time
+}
+
+// capturedBody records the trace when the reverse proxy closes it.
+type capturedBody struct {
+	io.ReadCloser
+	call       *call
+	statusCode int
+
+	stream *providers.StreamAccumulator
+	sse    sseReader
+	body   bytes.Buffer
+
+	firstByte time.Time
+	eof       bool
+	readErr   error
+	once      sync.Once
+}
+
+func newCapturedBody(c *call, resp *http.Response) *capturedBody {
+	b := &capturedBody{ReadCloser: resp.Body, call: c, statusCode: resp.StatusCode}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		b.stream, _ = providers.NewStreamAccumulator(c.provider, c.request)
+		if b.stream == nil {
+			b.stream, _ = providers.NewStreamAccumulator(c.provider, nil)
+		}
+		b.sse.dispatch = b.stream.Add
+	}
+	return b
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if b.firstByte.IsZero() {
+			b.firstByte = b.call.proxy.now()
+		}
+		if b.stream != nil {
+			b.sse.write(p[:n])
+		} else if b.body.Len()+n <= maxCaptureBytes {
+			b.body.Write(p[:n])
+		}
+	}
+	switch {
+	case errors.Is(err, io.EOF):
+		b.eof = true
+	case err != nil:
+		b.readErr = err
+	}
+	return n, err
+}
+
+func (b *capturedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.record)
+	return err
+}
+
+func (b *capturedBody) record() {
+	c := b.call
+	ended := c.proxy.now()
+
+	var extracted providers.Extraction
+	if b.stream != nil {
+		b.sse.flush()
+		extracted = b.stream.Result()
+	} else {
+		var err error
+		extracted, err = providers.Extract(c.provider, c.request, b.body.Bytes())
+		if err != nil {
+			// Not JSON, such as a gateway's HTML error page.
+			extracted, _ = providers.Extract(c.provider, c.request, nil)
+		}
+	}
+
+	status, errorType := "ok", extracted.ErrorType
+	if b.statusCode >= http.StatusBadRequest && errorType == "" {
+		errorType = fmt.Sprintf("http_%d", b.statusCode)
+	}
+	if errorType != "" {
+		status = "error"
+	}
+	switch {
+	case b.readErr != nil && errors.Is(b.readErr, context.Canceled):
+		status = "cancelled"
+	case b.readErr != nil:
+		status, errorType = "error", "upstream_read_error"
+	case !b.eof:
+		// The client went away before the response was fully relayed.
+		status = "cancelled"
+	}
+
+	details := extracted.Details()
+	details["capture"] = "proxy"
+	details["path"] = c.path
+	details["status_code"] = b.statusCode
+	trace := c.trace(extracted, status, errorType, ended, details)
+	if b.stream != nil && !b.firstByte.IsZero() {
+		trace.TTFTMS = int(b.firstByte.Sub(c.started).Milliseconds())
+		if elapsed := ended.Sub(b.firstByte).Seconds(); elapsed > 0 && extracted.CompletionTokens > 0 {
+			trace.TokensPerSec = float64(extracted.CompletionTokens) / elapsed
+		}
+	}
+	c.enqueue(trace)
+}
+
+// failed records a call that got no response.
+func (c *call) failed(err error) {
+	extracted, _ := providers.Extract(c.provider, c.request, nil)
+	status, errorType := "error", "upstream_unreachable"
+	if errors.Is(err, context.Canceled) {
+		status, errorType = "cancelled", ""
+	}
+	details := map[string]any{"capture": "proxy", "path": c.path, "error_message": err.Error()}
+	c.enqueue(c.trace(extracted, status, errorType, c.proxy.now(), details))
+}
+
+func (c *call) trace(extracted providers.Extraction, status, errorType string, ended time.Time, details map[string]any) *ingest.TracePayload {
+	model := extracted.Model
+	if model == "" {
+		model = modelFromPath(c.path)
+	}
+	return &ingest.TracePayload{
+		Provider:         c.provider,
+		Model:            model,
+		InputText:        extracted.InputText,
+		OutputText:       extracted.OutputText,
+		PromptTokens:     extracted.PromptTokens,
+		CompletionTokens: extracted.CompletionTokens,
+		TotalTokens:      extracted.TotalTokens,
+		LatencyMS:        int(ended.Sub(c.started).Milliseconds()),
+		Status:           status,
+		ErrorType:        errorType,
+		Metadata:         ingest.MergeMetadata("", details),
+		StartedAt:        c.started.UnixMilli(),
+		EndedAt:          ended.UnixMilli(),
+	}
+}
+
+func (c *call) enqueue(trace *ingest.TracePayload) {
+	c.proxy.enqueuer.Enqueue(ingest.Event{
+		Kind:      ingest.EventKindTrace,
+		CreatedAt: trace.StartedAt,
+		Trace:     trace,
+	})
+}
+
+func modelFromPath(path string) string {
+	_, rest, ok := strings.Cut(path, "/models/")
+	if !ok {
+		return "unknown"
+	}
+	model, _, _ := strings.Cut(rest, ":")
+	model, _, _ = strings.Cut(model, "/")
+	if model == "" {
+		return "unknown"
+	}
+	return model
+}
+
+type sseReader struct {
+	dispatch func(data []byte)
+	line     []byte
+	data     []byte
+}
+
+func (s *sseReader) write(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			if len(s.line)+len(p) <= maxCaptureBytes {
+				s.line = append(s.line, p...)
+			}
+			return
+		}
+		s.line = append(s.line, p[:i]...)
+		s.handleLine(bytes.TrimSuffix(s.line, []byte("\r")))
+		s.line = s.line[:0]
+		p = p[i+1:]
+	}
+}
+
+func (s *sseReader) handleLine(line []byte) {
+	if len(line) == 0 {
+		s.flush()
+		return
+	}
+	value, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	value = bytes.TrimPrefix(value, []byte(" "))
+	if len(s.data) > 0 {
+		s.data = append(s.data, '\n')
+	}
+	s.data = append(s.data, value...)
+}
+
+func (s *sseReader) flush() {
+	if len(s.line) > 0 {
+		line := s.line
+		s.line = nil
+		s.handleLine(bytes.TrimSuffix(line, []byte("\r")))
+	}
+	if len(s.data) > 0 {
+		s.dispatch(s.data)
+		s.data = s.data[:0]
+	}
+}
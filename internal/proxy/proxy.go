@@ -0,0 +1,141 @@
+// Package proxy forwards LLM API calls to their provider and traces each one.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+	"github.com/kon-rad/openclaw-trace/internal/providers"
+)
+
+const PathPrefix = "/proxy/"
+
+const (
+	DefaultOpenAIUpstream    = "https://api.openai.com"
+	DefaultAnthropicUpstream = "https://api.anthropic.com"
+	DefaultGeminiUpstream    = "https://generativelanguage.googleapis.com"
+
+	// Larger bodies are forwarded without being captured.
+	maxCaptureBytes = 4 << 20
+)
+
+type Enqueuer interface {
+	Enqueue(event ingest.Event) bool
+}
+
+type Proxy struct {
+	enqueuer  Enqueuer
+	upstreams map[string]*url.URL
+	reverse   *httputil.ReverseProxy
+	now       func() time.Time
+}
+
+type callKey struct{}
+
+func New(enqueuer Enqueuer, upstreams map[string]string) (*Proxy, error) {
+	p := &Proxy{enqueuer: enqueuer, upstreams: map[string]*url.URL{}, now: time.Now}
+	for provider, raw := range upstreams {
+		if raw == "" {
+			continue
+		}
+		if !slices.Contains(providers.Names(), provider) {
+			return nil, fmt.Errorf("unsupported proxy provider %q", provider)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s upstream %q", provider, raw)
+		}
+		p.upstreams[provider] = u
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 16
+	p.reverse = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		Transport:      transport,
+		FlushInterval:  -1,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.errorHandler,
+	}
+	return p, nil
+}
+
+// ServeHTTP forwards the request; only POSTs are traced.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	provider, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	upstream, ok := p.upstreams[provider]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// Streamed completions outlive the server's read and write timeouts.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	c := &call{
+		proxy:    p,
+		provider: provider,
+		upstream: upstream,
+		path:     "/" + path,
+		started:  p.now(),
+	}
+	if r.Method == http.MethodPost {
+		c.request = captureRequest(r)
+		c.traced = true
+	}
+	p.reverse.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callKey{}, c)))
+}
+
+func (p *Proxy) rewrite(pr *httputil.ProxyRequest) {
+	c := pr.In.Context().Value(callKey{}).(*call)
+	pr.Out.URL.Path = c.path
+	pr.Out.URL.RawPath = ""
+	pr.SetURL(c.upstream)
+	// Let the transport negotiate gzip so extraction sees a decoded body.
+	pr.Out.Header.Del("Accept-Encoding")
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	c := resp.Request.Context().Value(callKey{}).(*call)
+	if c.traced {
+		resp.Body = newCapturedBody(c, resp)
+	}
+	return nil
+}
+
+func (p *Proxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	c := r.Context().Value(callKey{}).(*call)
+	if c.traced {
+		c.failed(err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	http.Error(w, "upstream unavailable", http.StatusBadGateway)
+}
+
+func captureRequest(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxCaptureBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil || len(head) > maxCaptureBytes {
+		return nil
+	}
+	return head
+}
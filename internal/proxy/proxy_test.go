@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+type chanEnqueuer struct {
+	ch chan ingest.Event
+}
+
+func (e chanEnqueuer) Enqueue(event ingest.Event) bool {
+	return ingest.TryEnqueue(e.ch, event)
+}
+
+func newTestProxy(t *testing.T, provider string, upstream string) (*httptest.Server, chan ingest.Event) {
+	t.Helper()
+	ch := make(chan ingest.Event, 4)
+	p, err := New(chanEnqueuer{ch: ch}, map[string]string{provider: upstream})
+	if err != nil {
+		t.Fatalf("new proxy: %v", err)
+	}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func nextEvent(t *testing.T, ch chan ingest.Event) ingest.Event {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no trace recorded")
+		return ingest.Event{}
+	}
+}
+
+func TestProxyForwardsAndTracesCompletion(t *testing.T) {
+	t.Parallel()
+
+	const response = `{"object":"chat.completion","model":"gpt-4o-mini","choices":[{"finish_reason":"stop","message":{"content":"pong"}}],` +
+		`"usage":{"prompt_tokens":9,"completion_tokens":1,"total_tokens":10}}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" || !strings.Contains(string(body), "ping") {
+			http.Error(w, fmt.Sprintf("unexpected upstream request %s %q", r.URL.Path, body), http.StatusTeapot)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, response)
+	}))
+	defer upstream.Close()
+	srv, ch := newTestProxy(t, "openai", upstream.URL)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/proxy/openai/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"ping"}]}`))
+	req.Header.Set("Authorization", "Bearer sk-test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != response {
+		t.Fatalf("client got %d %q, want upstream response unchanged", resp.StatusCode, body)
+	}
+
+	trace := nextEvent(t, ch).Trace
+	if trace.Provider != "openai" || trace.Model != "gpt-4o-mini" || trace.Status != "ok" || trace.OutputText != "pong" {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	if trace.PromptTokens != 9 || trace.CompletionTokens != 1 || trace.TotalTokens != 10 {
+		t.Fatalf("unexpected usage: %+v", trace)
+	}
+	if trace.StartedAt == 0 || trace.EndedAt < trace.StartedAt || trace.TTFTMS != 0 {
+		t.Fatalf("unexpected timing: %+v", trace)
+	}
+	if !strings.Contains(trace.Metadata, `"capture":"proxy"`) || !strings.Contains(trace.Metadata, `"status_code":200`) {
+		t.Fatalf("metadata = %s", trace.Metadata)
+	}
+}
+
+func TestProxyTracesAnthropicStream(t *testing.T) {
+	t.Parallel()
+
+	events := []string{
+		`event: message_start` + "\n" + `data: {"type":"message_start","message":{"model":"claude-haiku-4-5","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`event: content_block_delta` + "\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`event: content_block_delta` + "\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+		`event: message_delta` + "\n" + `data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":20}}`,
+		`event: message_stop` + "\n" + `data: {"type":"message_stop"}`,
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		time.Sleep(20 * time.Millisecond)
+		for _, ev := range events {
+			_, _ = io.WriteString(w, ev+"\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer upstream.Close()
+	srv, ch := newTestProxy(t, "anthropic", upstream.URL)
+
+	resp, err := http.Post(srv.URL+"/proxy/anthropic/v1/messages", "application/json",
+		strings.NewReader(`{"model":"claude-haiku-4-5","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "message_stop") {
+		t.Fatalf("stream not relayed: %q", body)
+	}
+
+	trace := nextEvent(t, ch).Trace
+	if trace.Model != "claude-haiku-4-5" || trace.OutputText != "Hello" || trace.Status != "ok" {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	if trace.PromptTokens != 12 || trace.CompletionTokens != 20 || trace.TotalTokens != 32 {
+		t.Fatalf("unexpected usage: %+v", trace)
+	}
+	if trace.TTFTMS < 20 || trace.LatencyMS < trace.TTFTMS || trace.TokensPerSec <= 0 {
+		t.Fatalf("unexpected stream timing: ttft=%d latency=%d tps=%f", trace.TTFTMS, trace.LatencyMS, trace.TokensPerSec)
+	}
+}
+
+func TestProxyTracesUpstreamError(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, `{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`)
+	}))
+	defer upstream.Close()
+	srv, ch := newTestProxy(t, "openai", upstream.URL)
+
+	resp, err := http.Post(srv.URL+"/proxy/openai/v1/chat/completions", "application/json", strings.NewReader(`{"model":"gpt-4o"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want upstream 429", resp.StatusCode)
+	}
+
+	trace := nextEvent(t, ch).Trace
+	if trace.Status != "error" || trace.ErrorType != "rate_limit_exceeded" || trace.Model != "gpt-4o" {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+}
+
+func TestProxyTracesUnreachableUpstream(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstreamURL := upstream.URL
+	upstream.Close()
+	srv, ch := newTestProxy(t, "gemini", upstreamURL)
+
+	resp, err := http.Post(srv.URL+"/proxy/gemini/v1beta/models/gemini-2.5-flash:generateContent", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", resp.StatusCode)
+	}
+
+	trace := nextEvent(t, ch).Trace
+	if trace.Status != "error" || trace.ErrorType != "upstream_unreachable" || trace.Model != "gemini-2.5-flash" {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+}
+
+func TestProxyUnknownProviderAndUntracedMethods(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"data":[]}`)
+	}))
+	defer upstream.Close()
+	srv, ch := newTestProxy(t, "openai", upstream.URL)
+
+	resp, err := http.Get(srv.URL + "/proxy/cohere/v1/chat")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404 for unconfigured provider", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/proxy/openai/v1/models")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	select {
+	case ev := <-ch:
+		t.Fatalf("GET should not be traced, got %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNewRejectsInvalidUpstreams(t *testing.T) {
+	t.Parallel()
+
+	if _, err := New(chanEnqueuer{}, map[string]string{"openai": "ftp://example.com"}); err == nil {
+		t.Fatal("expected error for non-http upstream")
+	}
+	if _, err := New(chanEnqueuer{}, map[string]string{"mistral": "https://api.mistral.ai"}); err == nil {
+		t.Fatal("expected error for unsupported provider")
+	}
+}
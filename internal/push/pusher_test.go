@@ -39,8 +39,8 @@ func seedEvents(t *testing.T, dbm *db.Manager, count int) {
 	t.Helper()
 	for i := 0; i < count; i++ {
 		traceID := "00000000-0000-4000-8000-00000000000" + string(rune('a'+(i%26)))
-		err := dbm.InsertBatch(context.Background(),
-			[]db.TraceInsert{{
+		_, err := dbm.InsertBatch(context.Background(), db.Batch{
+			Traces: []db.TraceInsert{{
 				TraceID:    traceID,
 				CreatedAt:  time.Now().UnixMilli() + int64(i),
 				Provider:   "anthropic",
@@ -49,14 +49,14 @@ func seedEvents(t *testing.T, dbm *db.Manager, count int) {
 				OutputText: "output",
 				Status:     "ok",
 			}},
-			[]db.ErrorInsert{{
+			Errors: []db.ErrorInsert{{
 				TraceID:   traceID,
 				CreatedAt: time.Now().UnixMilli() + int64(i),
 				ErrorType: "llm_error",
 				Message:   "m",
 				Severity:  "error",
 			}},
-			[]db.MetricInsert{{
+			Metrics: []db.MetricInsert{{
 				TraceID:       traceID,
 				CreatedAt:     time.Now().UnixMilli() + int64(i),
 				CPUPct:        10,
@@ -67,7 +67,13 @@ func seedEvents(t *testing.T, dbm *db.Manager, count int) {
 				DiskTotal:     2,
 				DiskFreeBytes: 1,
 			}},
-		)
+			CustomEvents: []db.CustomEventInsert{{
+				TraceID:    traceID,
+				CreatedAt:  time.Now().UnixMilli() + int64(i),
+				Name:       "skill_invoked",
+				Attributes: `{"skill":"search"}`,
+			}},
+		})
 		if err != nil {
 			t.Fatalf("seed insert: %v", err)
 		}
@@ -99,12 +105,12 @@ func TestPushOnceSuccessMarksSynced(t *testing.T) {
 		t.Fatalf("expected pushed events")
 	}
 
-	tr, er, mr, err := dbm.PendingCounts(context.Background())
+	pending, err := dbm.PendingCounts(context.Background())
 	if err != nil {
 		t.Fatalf("pending counts: %v", err)
 	}
-	if tr != 0 || er != 0 || mr != 0 {
-		t.Fatalf("expected all synced, got traces=%d errors=%d metrics=%d", tr, er, mr)
+	if pending != (db.Pending{}) {
+		t.Fatalf("expected all synced, got %+v", pending)
 	}
 }
 
@@ -129,12 +135,45 @@ func TestPushOnceFailureKeepsUnsynced(t *testing.T) {
 		t.Fatalf("expected push failure")
 	}
 
-	tr, er, mr, err := dbm.PendingCounts(context.Background())
+	pending, err := dbm.PendingCounts(context.Background())
 	if err != nil {
 		t.Fatalf("pending counts: %v", err)
 	}
-	if tr == 0 || er == 0 || mr == 0 {
-		t.Fatalf("expected pending rows after failed push, got traces=%d errors=%d metrics=%d", tr, er, mr)
+	if pending.Traces == 0 || pending.Errors == 0 || pending.Metrics == 0 || pending.CustomEvents == 0 {
+		t.Fatalf("expected pending rows after failed push, got %+v", pending)
+	}
+}
+
+func TestPushOnceSendsToolCalls(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+	if _, err := dbm.InsertBatch(context.Background(), db.Batch{ToolCalls: []db.ToolCallInsert{{
+		TraceID:   "88888888-8888-4888-8888-888888888888",
+		CreatedAt: time.Now().UnixMilli(),
+		ToolName:  "web_fetch",
+		Arguments: `{"url":"https://example.com"}`,
+		Status:    "ok",
+	}}}); err != nil {
+		t.Fatalf("seed insert: %v", err)
+	}
+
+	transport := &mockTransport{statusCode: http.StatusOK}
+	p := New(dbm, "http://push.local/v1/ingest", 5*1024*1024)
+	p.SetTestOptions(&http.Client{Transport: transport, Timeout: 2 * time.Second}, 2, time.Millisecond)
+	if _, err := p.PushOnce(context.Background()); err != nil {
+		t.Fatalf("push once failed: %v", err)
+	}
+	if atomic.LoadInt64(&transport.eventsSeen) != 1 {
+		t.Fatalf("events seen = %d, want the tool call pushed", atomic.LoadInt64(&transport.eventsSeen))
+	}
+	pending, err := dbm.PendingCounts(context.Background())
+	if err != nil || pending.ToolCalls != 0 {
+		t.Fatalf("pending tool calls = %d, %v; want 0", pending.ToolCalls, err)
 	}
 }
 
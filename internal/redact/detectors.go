@@ -0,0 +1,56 @@
+package redact
+
+import "regexp"
+
+// Builtins lists the built-in detectors; phone numbers run last.
+var Builtins = []string{"api_key", "email", "credit_card", "phone"}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// Separators or a leading + keep plain ids and timestamps out.
+	phonePattern  = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\b\d{3}\)?[ .-]\d{3}[ .-]\d{4}\b|\+\d{10,14}\b`)
+	cardPattern   = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	apiKeyPattern = regexp.MustCompile(`\b(?:` +
+		`sk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}` + // OpenAI, Anthropic
+		`|sk_live_[A-Za-z0-9]{24,}` + // Stripe
+		`|AKIA[0-9A-Z]{16}` + // AWS access key id
+		`|gh[pousr]_[A-Za-z0-9]{36,}` + // GitHub
+		`|xox[abpr]-[A-Za-z0-9-]{10,}` + // Slack
+		`|AIza[0-9A-Za-z_-]{35}` + // Google
+		`)`)
+)
+
+func builtin(name string) (Rule, bool) {
+	switch name {
+	case "email":
+		return Rule{Name: name, Pattern: emailPattern}, true
+	case "phone":
+		return Rule{Name: name, Pattern: phonePattern}, true
+	case "credit_card":
+		return Rule{Name: name, Pattern: cardPattern, valid: luhn}, true
+	case "api_key":
+		return Rule{Name: name, Pattern: apiKeyPattern}, true
+	default:
+		return Rule{}, false
+	}
+}
+
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,85 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+const LeakErrorType = "security_leak"
+
+var (
+	jwtPattern        = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)
+	privateKeyPattern = regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY(?: BLOCK)?-----`)
+)
+
+var leakDetectors = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"api_key", apiKeyPattern},
+	{"jwt", jwtPattern},
+	{"private_key", privateKeyPattern},
+}
+
+// Leak locates a credential without holding it.
+type Leak struct {
+	Detector string `json:"detector"`
+	Field    string `json:"field"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+}
+
+// FindLeaks scans trace input and output for API keys, JWTs and private keys.
+func FindLeaks(trace *ingest.TracePayload) []Leak {
+	var leaks []Leak
+	for _, field := range []struct {
+		name string
+		text string
+	}{
+		{"input_text", trace.InputText},
+		{"output_text", trace.OutputText},
+	} {
+		if field.text == "" {
+			continue
+		}
+		for _, d := range leakDetectors {
+			for _, loc := range d.pattern.FindAllStringIndex(field.text, -1) {
+				leaks = append(leaks, Leak{Detector: d.name, Field: field.name, Offset: loc[0], Length: loc[1] - loc[0]})
+			}
+		}
+	}
+	return leaks
+}
+
+// LeakEvent flags a trace the sampler dropped or stripped of its text, since
+// the reported offsets then point at nothing stored.
+func LeakEvent(traceID string, trace *ingest.TracePayload, leaks []Leak, createdAt int64) ingest.Event {
+	var found []string
+	for _, leak := range leaks {
+		found = append(found, leak.Detector+" in "+leak.Field)
+	}
+	message := fmt.Sprintf("credential detected in trace %s: %s", traceID, strings.Join(found, ", "))
+	fields := map[string]any{"trace_id": traceID, "leaks": leaks}
+	switch {
+	case trace.SampledOut:
+		message += " (trace sampled out, not stored)"
+		fields["sampled_out"] = true
+	case trace.TextDropped:
+		message += " (trace stored without text)"
+		fields["text_dropped"] = true
+	}
+	return ingest.Event{
+		Kind:      ingest.EventKindError,
+		CreatedAt: createdAt,
+		Error: &ingest.ErrorPayload{
+			ErrorType:  LeakErrorType,
+			Message:    message,
+			Severity:   "critical",
+			Metadata:   ingest.MergeMetadata("", fields),
+			LLMTraceID: traceID,
+		},
+	}
+}
@@ -0,0 +1,216 @@
+// Package redact removes personal data and secrets from events before they are queued.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+type Mode string
+
+const (
+	ModeMask Mode = "mask"
+	// ModeHash keeps equal values correlatable as [<rule>:<digest>].
+	ModeHash Mode = "hash"
+	ModeDrop Mode = "drop"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeMask, ModeHash, ModeDrop:
+		return m, nil
+	case "":
+		return ModeMask, nil
+	default:
+		return "", fmt.Errorf("unknown redaction mode %q", s)
+	}
+}
+
+// ErrNoHashKey is returned by New when a rule hashes without a key. An
+// unkeyed digest of a short value such as a phone number is easily reversed.
+var ErrNoHashKey = errors.New("hash mode requires a hash key")
+
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Mode    Mode
+	valid   func(string) bool
+}
+
+type CustomRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Mode    string `json:"mode"`
+}
+
+type Redactor struct {
+	rules   []Rule
+	hashKey []byte
+	hits    []atomic.Int64
+}
+
+// New builds a redactor from the named built-in detectors, each optionally
+// suffixed with ":<mode>" (for example "email:hash"), followed by custom
+// rules. Rules without a mode use defaultMode. hashKey keys the digests of
+// ModeHash and must be set when any rule uses it.
+func New(builtins []string, custom []CustomRule, defaultMode Mode, hashKey string) (*Redactor, error) {
+	r := &Redactor{hashKey: []byte(hashKey)}
+	for _, spec := range builtins {
+		name, modeName, _ := strings.Cut(strings.TrimSpace(spec), ":")
+		if name == "" {
+			continue
+		}
+		rule, ok := builtin(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %q", name)
+		}
+		mode, err := ruleMode(modeName, defaultMode)
+		if err != nil {
+			return nil, err
+		}
+		rule.Mode = mode
+		r.rules = append(r.rules, rule)
+	}
+	for _, c := range custom {
+		if c.Name == "" {
+			return nil, fmt.Errorf("custom redaction rule with pattern %q has no name", c.Pattern)
+		}
+		pattern, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("custom redaction rule %q: %w", c.Name, err)
+		}
+		mode, err := ruleMode(c.Mode, defaultMode)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, Rule{Name: c.Name, Pattern: pattern, Mode: mode})
+	}
+	for _, rule := range r.rules {
+		if rule.Mode == ModeHash && len(r.hashKey) == 0 {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, ErrNoHashKey)
+		}
+	}
+	r.hits = make([]atomic.Int64, len(r.rules))
+	return r, nil
+}
+
+func ParseCustomRules(s string) ([]CustomRule, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var rules []CustomRule
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return nil, fmt.Errorf("decode custom redaction rules: %w", err)
+	}
+	return rules, nil
+}
+
+func ruleMode(name string, fallback Mode) (Mode, error) {
+	if name == "" {
+		return fallback, nil
+	}
+	return ParseMode(name)
+}
+
+// Redact rewrites the free-text fields of event in place.
+func (r *Redactor) Redact(event *ingest.Event) {
+	switch {
+	case event.Trace != nil:
+		t := event.Trace
+		t.InputText = r.text(t.InputText)
+		t.OutputText = r.text(t.OutputText)
+		t.Metadata = r.json(t.Metadata)
+	case event.Error != nil:
+		e := event.Error
+		e.Message = r.text(e.Message)
+		e.StackTrace = r.text(e.StackTrace)
+		e.Metadata = r.json(e.Metadata)
+	case event.ToolCall != nil:
+		c := event.ToolCall
+		c.Arguments = r.text(c.Arguments)
+		c.ErrorMessage = r.text(c.ErrorMessage)
+		c.Metadata = r.json(c.Metadata)
+	case event.Custom != nil:
+		c := event.Custom
+		c.Attributes = r.json(c.Attributes)
+		c.Metadata = r.json(c.Metadata)
+	}
+}
+
+func (r *Redactor) Process(event *ingest.Event) bool {
+	r.Redact(event)
+	return true
+}
+
+func (r *Redactor) Hits() map[string]int64 {
+	out := make(map[string]int64, len(r.rules))
+	for i, rule := range r.rules {
+		out[rule.Name] += r.hits[i].Load()
+	}
+	return out
+}
+
+// Text returns s redacted without counting hits, for text whose stored form
+// is redacted again on its way to the queue.
+func (r *Redactor) Text(s string) string {
+	return r.apply(s, false)
+}
+
+func (r *Redactor) text(s string) string {
+	return r.apply(s, true)
+}
+
+func (r *Redactor) apply(s string, count bool) string {
+	if s == "" {
+		return s
+	}
+	for i, rule := range r.rules {
+		matched := 0
+		s = rule.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.valid != nil && !rule.valid(match) {
+				return match
+			}
+			matched++
+			switch rule.Mode {
+			case ModeHash:
+				return "[" + rule.Name + ":" + r.digest(match) + "]"
+			default:
+				return "[REDACTED:" + rule.Name + "]"
+			}
+		})
+		if matched == 0 {
+			continue
+		}
+		if count {
+			r.hits[i].Add(int64(matched))
+		}
+		if rule.Mode == ModeDrop {
+			return ""
+		}
+	}
+	return s
+}
+
+// json drops a document that redaction left invalid rather than store it broken.
+func (r *Redactor) json(s string) string {
+	out := r.text(s)
+	if out == s || out == "" || json.Valid([]byte(out)) {
+		return out
+	}
+	return ""
+}
+
+func (r *Redactor) digest(match string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(match))
+	return hex.EncodeToString(mac.Sum(nil)[:6])
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+// sourceMetadataKey is the metadata field that records which token
+// authenticated an event. It overwrites any client-supplied value so sources
+// cannot be forged.
+const sourceMetadataKey = "auth_source"
+
+type sourceContextKey struct{}
+
+// AccessControl restricts ingest to clients from allowed networks and, when
+// tokens are configured, to requests carrying a bearer token. Each token is
+// labelled with a source name that is stamped into event metadata.
+type AccessControl struct {
+	tokens        []sourceToken
+	allowed       []netip.Prefix
+	protectHealth bool
+}
+
+type sourceToken struct {
+	source string
+	token  []byte
+}
+
+// ParseTokens parses a comma-separated list of source:token pairs.
+func ParseTokens(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		source, token, ok := strings.Cut(item, ":")
+		source, token = strings.TrimSpace(source), strings.TrimSpace(token)
+		if !ok || source == "" || token == "" {
+			return nil, fmt.Errorf("token entry %q must have the form source:token", item)
+		}
+		if _, dup := out[token]; dup {
+			return nil, fmt.Errorf("token for source %q is configured twice", source)
+		}
+		out[token] = source
+	}
+	return out, nil
+}
+
+// ParseCIDRs parses a comma-separated list of CIDR prefixes. Bare addresses
+// are accepted as single-host prefixes.
+func ParseCIDRs(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", item, err)
+			}
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", item, err)
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out, nil
+}
+
+// NewAccessControl takes tokens mapped to their source names. With no tokens
+// and no prefixes every request is allowed.
+func NewAccessControl(tokens map[string]string, allowed []netip.Prefix) *AccessControl {
+	a := &AccessControl{allowed: allowed}
+	for token, source := range tokens {
+		a.tokens = append(a.tokens, sourceToken{source: source, token: []byte(token)})
+	}
+	return a
+}
+
+// SetProtectHealth applies the allowlist and token check to /health too.
+// Health stays open by default so local probes keep working.
+func (a *AccessControl) SetProtectHealth(protect bool) {
+	a.protectHealth = protect
+}
+
+// Wrap rejects requests from disallowed networks with 403 and requests
+// without a valid token with 401. The authenticated source is attached to
+// the request context.
+func (a *AccessControl) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowedAddr(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		source, err := a.authenticate(bearerToken(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="openclaw-trace"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if source != "" {
+			r = r.WithContext(context.WithValue(r.Context(), sourceContextKey{}, source))
+		}
+		next(w, r)
+	}
+}
+
+// ProxyTokenHeader carries the sidecar token on proxied requests, whose
+// Authorization header holds the provider's API key. It is removed before
+// the request is forwarded.
+const ProxyTokenHeader = "X-OCT-Token"
+
+// wrapProxy is Wrap for the provider proxy, reading the token from
+// ProxyTokenHeader.
+func (a *AccessControl) wrapProxy(next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowedAddr(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		token := strings.TrimSpace(r.Header.Get(ProxyTokenHeader))
+		r.Header.Del(ProxyTokenHeader)
+		source, err := a.authenticate(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if source != "" {
+			r = r.WithContext(context.WithValue(r.Context(), sourceContextKey{}, source))
+		}
+		next(w, r)
+	}
+}
+
+func (a *AccessControl) wrapHealth(next http.HandlerFunc) http.HandlerFunc {
+	if a == nil || !a.protectHealth {
+		return next
+	}
+	return a.Wrap(next)
+}
+
+// allowedAddr checks a remote address in host:port form. Addresses that do
+// not parse as IP come from the Unix socket listener, whose access is
+// governed by the socket file permissions.
+func (a *AccessControl) allowedAddr(remote string) bool {
+	if len(a.allowed) == 0 {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(remote)
+	if err != nil {
+		return remote == "" || remote == "@"
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range a.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate returns the source for token. Every configured token is
+// compared so the time taken does not reveal which one matched.
+func (a *AccessControl) authenticate(token string) (string, error) {
+	if len(a.tokens) == 0 {
+		return "", nil
+	}
+	if token == "" {
+		return "", errors.New("missing bearer token")
+	}
+	source := ""
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t.token, []byte(token)) == 1 {
+			source = t.source
+		}
+	}
+	if source == "" {
+		return "", errors.New("invalid bearer token")
+	}
+	return source, nil
+}
+
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func sourceFromContext(ctx context.Context) string {
+	source, _ := ctx.Value(sourceContextKey{}).(string)
+	return source
+}
+
+func stampSource(event *ingest.Event, source string) {
+	if source != "" {
+		event.MergeMetadata(map[string]any{sourceMetadataKey: source})
+	}
+}
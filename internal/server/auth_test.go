@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+func TestParseTokensAndCIDRs(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := ParseTokens("agent:s3cret, cron : other ")
+	if err != nil {
+		t.Fatalf("parse tokens: %v", err)
+	}
+	if tokens["s3cret"] != "agent" || tokens["other"] != "cron" {
+		t.Fatalf("unexpected tokens: %v", tokens)
+	}
+	for _, bad := range []string{"no-source", ":token", "a:t,b:t"} {
+		if _, err := ParseTokens(bad); err == nil {
+			t.Fatalf("ParseTokens(%q): expected error", bad)
+		}
+	}
+
+	prefixes, err := ParseCIDRs("127.0.0.1, 10.0.0.0/8,::1")
+	if err != nil {
+		t.Fatalf("parse cidrs: %v", err)
+	}
+	if len(prefixes) != 3 || prefixes[0].Bits() != 32 || prefixes[2].Bits() != 128 {
+		t.Fatalf("unexpected prefixes: %v", prefixes)
+	}
+	if _, err := ParseCIDRs("10.0.0.0/33"); err == nil {
+		t.Fatalf("expected error for invalid cidr")
+	}
+}
+
+func TestAccessControlGuardsIngest(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 4)
+	allowed, _ := ParseCIDRs("10.0.0.0/8")
+	access := NewAccessControl(map[string]string{"s3cret": "agent"}, allowed)
+	healthCalls := 0
+	srv := New(":0", func(w http.ResponseWriter, _ *http.Request) {
+		healthCalls++
+		w.WriteHeader(http.StatusOK)
+	}, NewIngestHandlers(chanEnqueuer{ch: ch}), access)
+
+	send := func(remote, token string) int {
+		body := []byte(`{"name":"skill_invoked","metadata":{"auth_source":"forged"}}`)
+		req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewReader(body))
+		req.RemoteAddr = remote
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send("192.0.2.1:4000", "s3cret"); code != http.StatusForbidden {
+		t.Fatalf("outside allowlist status = %d, want 403", code)
+	}
+	if code := send("10.1.2.3:4000", ""); code != http.StatusUnauthorized {
+		t.Fatalf("missing token status = %d, want 401", code)
+	}
+	if code := send("10.1.2.3:4000", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token status = %d, want 401", code)
+	}
+	if code := send("10.1.2.3:4000", "s3cret"); code != http.StatusAccepted {
+		t.Fatalf("valid token status = %d, want 202", code)
+	}
+
+	ev := <-ch
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(ev.Custom.Metadata), &meta); err != nil || meta["auth_source"] != "agent" {
+		t.Fatalf("metadata = %s, want auth_source stamped as agent", ev.Custom.Metadata)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || healthCalls != 1 {
+		t.Fatalf("health status = %d, want open by default", rec.Code)
+	}
+
+	access.SetProtectHealth(true)
+	protected := New(":0", func(w http.ResponseWriter, _ *http.Request) {}, nil, access)
+	rec = httptest.NewRecorder()
+	protected.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("protected health status = %d, want 403", rec.Code)
+	}
+}
+
+func TestAccessControlGuardsProxyWithTokenOnly(t *testing.T) {
+	t.Parallel()
+
+	var forwarded http.Header
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	h.SetProxy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	access := NewAccessControl(map[string]string{"s3cret": "agent"}, nil)
+	srv := New(":0", func(http.ResponseWriter, *http.Request) {}, h, access)
+
+	send := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/proxy/openai/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer sk-provider")
+		if token != "" {
+			req.Header.Set(ProxyTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send(""); code != http.StatusUnauthorized || forwarded != nil {
+		t.Fatalf("missing token status = %d, want 401 without forwarding", code)
+	}
+	if code := send("wrong"); code != http.StatusUnauthorized || forwarded != nil {
+		t.Fatalf("wrong token status = %d, want 401 without forwarding", code)
+	}
+	if code := send("s3cret"); code != http.StatusOK {
+		t.Fatalf("valid token status = %d, want 200", code)
+	}
+	if forwarded.Get(ProxyTokenHeader) != "" || forwarded.Get("Authorization") != "Bearer sk-provider" {
+		t.Fatalf("forwarded headers = %v, want sidecar token stripped and provider key kept", forwarded)
+	}
+}
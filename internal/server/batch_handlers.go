@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+const (
+	maxBatchBodyBytes = 5 << 20
+	maxBatchItems     = 1000
+	maxBatchErrors    = 20
+)
+
+type batchItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type batchResponse struct {
+	Accepted int              `json:"accepted"`
+	Rejected int              `json:"rejected"`
+	Dropped  int              `json:"dropped"`
+	Errors   []batchItemError `json:"errors,omitempty"`
+}
+
+// PostBatch ingests many items in one request. The body is either a JSON
+// array or newline-delimited JSON; every item carries a "type" of trace,
+// error, event or tool_call and otherwise uses the same fields as the single-item
+// endpoints. Invalid items are rejected individually without failing the
+// rest of the batch. When the queue rejects items and the reject policy is
+// active the response is 429 with the same counts, so the client can resend
+// the dropped items.
+func (h *IngestHandlers) PostBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "batch too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return
+	}
+
+	items, err := splitBatch(body)
+	if err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxBatchItems {
+		http.Error(w, fmt.Sprintf("batch exceeds %d items", maxBatchItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	tb := h.bounds()
+	var resp batchResponse
+	for i, raw := range items {
+		event, err := decodeItem(raw, tb)
+		if err != nil {
+			resp.Rejected++
+			if len(resp.Errors) < maxBatchErrors {
+				resp.Errors = append(resp.Errors, batchItemError{Index: i, Error: err.Error()})
+			}
+			continue
+		}
+		if h.enqueue(r, event) {
+			resp.Accepted++
+		} else {
+			resp.Dropped++
+		}
+	}
+
+	status := http.StatusAccepted
+	if resp.Dropped > 0 && h.rejectWhenFull {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		status = http.StatusTooManyRequests
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// splitBatch returns the raw items of a JSON array or an NDJSON body. A
+// malformed array fails as a whole; malformed NDJSON lines are returned as-is
+// and rejected per item by decodeItem.
+func splitBatch(body []byte) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	var items []json.RawMessage
+	for _, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		items = append(items, json.RawMessage(line))
+	}
+	return items, nil
+}
+
+func decodeItem(raw json.RawMessage, tb ingest.TimeBounds) (ingest.Event, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return ingest.Event{}, errors.New("invalid json")
+	}
+
+	switch head.Type {
+	case "trace":
+		var req traceRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return ingest.Event{}, errors.New("invalid json")
+		}
+		return req.toEvent(tb)
+	case "error":
+		var req errorRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return ingest.Event{}, errors.New("invalid json")
+		}
+		return req.toEvent(tb)
+	case "event":
+		var req eventRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return ingest.Event{}, errors.New("invalid json")
+		}
+		return req.toEvent(tb)
+	case "tool_call":
+		var req toolCallRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return ingest.Event{}, errors.New("invalid json")
+		}
+		return req.toEvent(tb)
+	case "provider_trace":
+		var req providerTraceRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return ingest.Event{}, errors.New("invalid json")
+		}
+		return req.toEvent(tb)
+	case "":
+		return ingest.Event{}, errors.New("type is required")
+	default:
+		return ingest.Event{}, fmt.Errorf("unknown type %q", head.Type)
+	}
+}
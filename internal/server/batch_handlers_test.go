@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/kon-rad/openclaw-trace/internal/db"
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+func TestPostBatchNDJSONPersistsMixedItems(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ch := make(chan ingest.Event, ingest.QueueCapacity)
+	worker := ingest.NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ch) }()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	body := []byte(`{"type":"trace","provider":"anthropic","model":"claude-sonnet-4"}
+{"type":"trace","provider":"openai","model":"gpt-4o"}
+
+{"type":"error","error_type":"llm_error","message":"rate limited"}
+{"type":"event","name":"user_onboarded"}
+{"type":"trace","model":"missing-provider"}
+not json
+{"type":"span"}
+`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostBatch(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Accepted != 4 || resp.Rejected != 3 || resp.Dropped != 0 {
+		t.Fatalf("unexpected counts: %+v", resp)
+	}
+	if len(resp.Errors) != 3 || resp.Errors[0].Index != 4 {
+		t.Fatalf("unexpected item errors: %+v", resp.Errors)
+	}
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	pending, err := dbm.PendingCounts(context.Background())
+	if err != nil {
+		t.Fatalf("pending counts: %v", err)
+	}
+	if pending.Traces != 2 || pending.Errors != 1 || pending.CustomEvents != 1 {
+		t.Fatalf("persisted traces=%d errors=%d events=%d, want 2/1/1", pending.Traces, pending.Errors, pending.CustomEvents)
+	}
+}
+
+func TestPostBatchJSONArrayReportsDropped(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 2)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	body := []byte(`[
+		{"type":"trace","provider":"anthropic","model":"claude-sonnet-4"},
+		{"type":"trace","provider":"anthropic","model":"claude-sonnet-4"},
+		{"type":"trace","provider":"anthropic","model":"claude-sonnet-4"}
+	]`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostBatch(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Accepted != 2 || resp.Dropped != 1 || resp.Rejected != 0 {
+		t.Fatalf("unexpected counts: %+v", resp)
+	}
+}
+
+func TestPostBatchRejectsMalformedArray(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", bytes.NewReader([]byte(`[{"type":"trace"},`)))
+	rec := httptest.NewRecorder()
+	h.PostBatch(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status code = %d, want 400", rec.Code)
+	}
+}
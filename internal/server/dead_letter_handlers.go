@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/kon-rad/openclaw-trace/internal/db"
+)
+
+const (
+	defaultDeadLetterLimit = 100
+	maxDeadLetterLimit     = 1000
+)
+
+// DeadLetterStore reads and purges events the worker could not store.
+type DeadLetterStore interface {
+	ListDeadLetters(ctx context.Context, limit int, beforeID int64) ([]db.DeadLetterRow, error)
+	PurgeDeadLetters(ctx context.Context, ids []int64) (int64, error)
+	DeadLetterCount(ctx context.Context) (int64, error)
+}
+
+type deadLetterResponse struct {
+	ID        int64           `json:"id"`
+	CreatedAt int64           `json:"created_at"`
+	Kind      string          `json:"kind"`
+	TraceID   string          `json:"trace_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	Error     string          `json:"error"`
+}
+
+type deadLetterListResponse struct {
+	DeadLetters []deadLetterResponse `json:"dead_letters"`
+	Total       int64                `json:"total"`
+}
+
+type deadLetterPurgeResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+// SetDeadLetterStore enables the dead-letter endpoints.
+func (h *IngestHandlers) SetDeadLetterStore(store DeadLetterStore) {
+	h.deadLetters = store
+}
+
+// GetDeadLetters lists dead letters newest first. before_id pages backwards
+// from the last id of the previous response.
+func (h *IngestHandlers) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if h.deadLetters == nil {
+		http.NotFound(w, r)
+		return
+	}
+	limit := defaultDeadLetterLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxDeadLetterLimit)
+	}
+	var beforeID int64
+	if v := r.URL.Query().Get("before_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			http.Error(w, "before_id must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		beforeID = n
+	}
+
+	rows, err := h.deadLetters.ListDeadLetters(r.Context(), limit, beforeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	total, err := h.deadLetters.DeadLetterCount(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := deadLetterListResponse{DeadLetters: make([]deadLetterResponse, 0, len(rows)), Total: total}
+	for _, row := range rows {
+		payload := json.RawMessage(row.Payload)
+		if !json.Valid(payload) {
+			// Keep the response valid JSON even if a payload is not.
+			payload, _ = json.Marshal(row.Payload)
+		}
+		resp.DeadLetters = append(resp.DeadLetters, deadLetterResponse{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			Kind:      row.Kind,
+			TraceID:   row.TraceID,
+			Payload:   payload,
+			Error:     row.Error,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteDeadLetters purges the dead letters named by repeated id parameters,
+// or all of them when none are given.
+func (h *IngestHandlers) DeleteDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if h.deadLetters == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var ids []int64
+	for _, v := range r.URL.Query()["id"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "id must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	purged, err := h.deadLetters.PurgeDeadLetters(r.Context(), ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(deadLetterPurgeResponse{Purged: purged})
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/kon-rad/openclaw-trace/internal/db"
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+func TestDeadLetterEndpointsListAndPurge(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	var rows []db.DeadLetterInsert
+	for i := range 3 {
+		rows = append(rows, db.DeadLetterInsert{
+			CreatedAt: int64(1000 + i),
+			Kind:      "custom",
+			TraceID:   fmt.Sprintf("t%d", i),
+			Payload:   fmt.Sprintf(`{"Kind":"custom","TraceID":"t%d"}`, i),
+			Error:     "CHECK constraint failed",
+		})
+	}
+	if err := dbm.InsertDeadLetters(context.Background(), rows); err != nil {
+		t.Fatalf("insert dead letters: %v", err)
+	}
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	h.SetDeadLetterStore(dbm)
+	srv := New(":0", func(http.ResponseWriter, *http.Request) {}, h, nil)
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/v1/dead_letters?limit=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var list struct {
+		DeadLetters []struct {
+			ID      int64           `json:"id"`
+			TraceID string          `json:"trace_id"`
+			Payload json.RawMessage `json:"payload"`
+			Error   string          `json:"error"`
+		} `json:"dead_letters"`
+		Total int64 `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if list.Total != 3 || len(list.DeadLetters) != 2 || list.DeadLetters[0].TraceID != "t2" {
+		t.Fatalf("unexpected list: %s", rec.Body.String())
+	}
+	if string(list.DeadLetters[0].Payload) != `{"Kind":"custom","TraceID":"t2"}` {
+		t.Fatalf("payload = %s, want the raw event", list.DeadLetters[0].Payload)
+	}
+
+	if rec := do(http.MethodGet, "/v1/dead_letters?limit=abc"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad limit status = %d, want 400", rec.Code)
+	}
+
+	rec = do(http.MethodDelete, fmt.Sprintf("/v1/dead_letters?id=%d", list.DeadLetters[0].ID))
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"purged\":1}\n" {
+		t.Fatalf("purge one = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = do(http.MethodDelete, "/v1/dead_letters")
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"purged\":2}\n" {
+		t.Fatalf("purge all = %d %s", rec.Code, rec.Body.String())
+	}
+}
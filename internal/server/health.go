@@ -7,14 +7,31 @@ import (
 	"time"
 
 	"github.com/kon-rad/openclaw-trace/internal/db"
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
 )
 
 type RuntimeSnapshot struct {
-	QueueDepth     int64
-	EventsReceived int64
-	EventsDropped  int64
-	LastPushTime   *int64
-	LastPushStatus string
+	QueueDepth         int64
+	QueuePolicy        string
+	EventsReceived     int64
+	EventsDropped      int64
+	EventsFiltered     int64
+	DroppedByKind      map[string]int64
+	EventsDuplicate    int64
+	EventsDeadLettered int64
+	WorkerState        string
+	WorkerRestarts     int64
+	WorkerFailing      bool
+	WorkerLastError    string
+	StreamsOpen        int64
+	StreamsAbandoned   int64
+	UDP                *UDPStats
+	Spill              *ingest.SpillStats
+	Sampling           *ingest.SampleStats
+	RedactionHits      map[string]int64
+	SecurityLeaks      int64
+	LastPushTime       *int64
+	LastPushStatus     string
 }
 
 type SnapshotProvider interface {
@@ -22,20 +39,36 @@ type SnapshotProvider interface {
 }
 
 type HealthResponse struct {
-	Status         string   `json:"status"`
-	UptimeSeconds  int64    `json:"uptime_seconds"`
-	Version        string   `json:"version"`
-	DBStatus       string   `json:"db_status"`
-	DBSizeBytes    int64    `json:"db_size_bytes"`
-	WALSizeBytes   int64    `json:"wal_size_bytes"`
-	QueueDepth     int64    `json:"queue_depth"`
-	EventsReceived int64    `json:"events_received"`
-	EventsDropped  int64    `json:"events_dropped"`
-	LastPushTime   *int64   `json:"last_push_time"`
-	LastPushStatus string   `json:"last_push_status"`
-	UnsyncedCount  int64    `json:"unsynced_count"`
-	GeneratedAt    string   `json:"generated_at"`
-	Warnings       []string `json:"warnings,omitempty"`
+	Status             string                   `json:"status"`
+	UptimeSeconds      int64                    `json:"uptime_seconds"`
+	Version            string                   `json:"version"`
+	DBStatus           string                   `json:"db_status"`
+	DBSizeBytes        int64                    `json:"db_size_bytes"`
+	WALSizeBytes       int64                    `json:"wal_size_bytes"`
+	QueueDepth         int64                    `json:"queue_depth"`
+	QueuePolicy        string                   `json:"queue_full_policy,omitempty"`
+	EventsReceived     int64                    `json:"events_received"`
+	EventsDropped      int64                    `json:"events_dropped"`
+	EventsFiltered     int64                    `json:"events_filtered"`
+	DroppedByKind      map[string]int64         `json:"events_dropped_by_kind,omitempty"`
+	EventsDuplicate    int64                    `json:"events_duplicate"`
+	EventsDeadLettered int64                    `json:"events_dead_lettered"`
+	WorkerState        string                   `json:"worker_state"`
+	WorkerRestarts     int64                    `json:"worker_restarts"`
+	WorkerLastError    string                   `json:"worker_last_error,omitempty"`
+	StreamsOpen        int64                    `json:"streams_open"`
+	StreamsAbandoned   int64                    `json:"streams_abandoned"`
+	UDP                *UDPStats                `json:"udp,omitempty"`
+	Spill              *ingest.SpillStats       `json:"spill,omitempty"`
+	Sampling           *ingest.SampleStats      `json:"sampling,omitempty"`
+	LastPushTime       *int64                   `json:"last_push_time"`
+	LastPushStatus     string                   `json:"last_push_status"`
+	RedactionHits      map[string]int64         `json:"redaction_hits,omitempty"`
+	SecurityLeaks      int64                    `json:"security_leaks"`
+	Compression        *db.CompressedSinceStart `json:"compressed_since_start,omitempty"`
+	UnsyncedCount      int64                    `json:"unsynced_count"`
+	GeneratedAt        string                   `json:"generated_at"`
+	Warnings           []string                 `json:"warnings,omitempty"`
 }
 
 type HealthHandler struct {
@@ -62,21 +95,40 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	unsynced, err := h.dbm.UnsyncedCount(context.Background())
 
 	resp := HealthResponse{
-		Status:         "ok",
-		UptimeSeconds:  int64(time.Since(h.startTime).Seconds()),
-		Version:        h.version,
-		DBStatus:       dbStats.DBStatus,
-		DBSizeBytes:    dbStats.DBSizeBytes,
-		WALSizeBytes:   dbStats.WALSize,
-		QueueDepth:     snapshot.QueueDepth,
-		EventsReceived: snapshot.EventsReceived,
-		EventsDropped:  snapshot.EventsDropped,
-		LastPushTime:   snapshot.LastPushTime,
-		LastPushStatus: snapshot.LastPushStatus,
-		UnsyncedCount:  unsynced,
-		GeneratedAt:    time.Now().UTC().Format(time.RFC3339),
+		Status:             "ok",
+		UptimeSeconds:      int64(time.Since(h.startTime).Seconds()),
+		Version:            h.version,
+		DBStatus:           dbStats.DBStatus,
+		DBSizeBytes:        dbStats.DBSizeBytes,
+		WALSizeBytes:       dbStats.WALSize,
+		QueueDepth:         snapshot.QueueDepth,
+		QueuePolicy:        snapshot.QueuePolicy,
+		EventsReceived:     snapshot.EventsReceived,
+		EventsDropped:      snapshot.EventsDropped,
+		EventsFiltered:     snapshot.EventsFiltered,
+		DroppedByKind:      snapshot.DroppedByKind,
+		EventsDuplicate:    snapshot.EventsDuplicate,
+		EventsDeadLettered: snapshot.EventsDeadLettered,
+		WorkerState:        snapshot.WorkerState,
+		WorkerRestarts:     snapshot.WorkerRestarts,
+		WorkerLastError:    snapshot.WorkerLastError,
+		StreamsOpen:        snapshot.StreamsOpen,
+		StreamsAbandoned:   snapshot.StreamsAbandoned,
+		UDP:                snapshot.UDP,
+		Spill:              snapshot.Spill,
+		Sampling:           snapshot.Sampling,
+		RedactionHits:      snapshot.RedactionHits,
+		SecurityLeaks:      snapshot.SecurityLeaks,
+		LastPushTime:       snapshot.LastPushTime,
+		LastPushStatus:     snapshot.LastPushStatus,
+		UnsyncedCount:      unsynced,
+		GeneratedAt:        time.Now().UTC().Format(time.RFC3339),
 	}
 
+	if h.dbm.CompressionEnabled() {
+		stats := h.dbm.CompressedSinceStart()
+		resp.Compression = &stats
+	}
 	if h.pushDisabled && resp.LastPushStatus == "" {
 		resp.LastPushStatus = "disabled"
 	}
@@ -88,6 +140,10 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	if resp.DBStatus != "ok" {
 		resp.Status = "degraded"
 	}
+	if snapshot.WorkerFailing {
+		resp.Status = "degraded"
+		resp.Warnings = append(resp.Warnings, "persistence_failing")
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
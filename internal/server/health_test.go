@@ -59,6 +59,7 @@ func TestHealthAlwaysReturnsContract(t *testing.T) {
 		"queue_depth",
 		"events_received",
 		"events_dropped",
+		"events_duplicate",
 		"last_push_time",
 		"last_push_status",
 		"unsynced_count",
@@ -69,3 +70,39 @@ func TestHealthAlwaysReturnsContract(t *testing.T) {
 		}
 	}
 }
+
+type failingWorkerSnapshot struct{}
+
+func (failingWorkerSnapshot) Snapshot() RuntimeSnapshot {
+	return RuntimeSnapshot{
+		WorkerState:     "restarting",
+		WorkerRestarts:  3,
+		WorkerFailing:   true,
+		WorkerLastError: "insert batch: disk I/O error",
+	}
+}
+
+func TestHealthDegradedWhilePersistenceFails(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	handler := NewHealthHandler(dbm, time.Now(), "test-version", failingWorkerSnapshot{}, true)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var body HealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json decode error = %v", err)
+	}
+	if body.Status != "degraded" || body.WorkerState != "restarting" || body.WorkerRestarts != 3 || body.WorkerLastError == "" {
+		t.Fatalf("unexpected health: %+v", body)
+	}
+	if len(body.Warnings) != 1 || body.Warnings[0] != "persistence_failing" {
+		t.Fatalf("warnings = %v", body.Warnings)
+	}
+}
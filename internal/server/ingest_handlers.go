@@ -1,11 +1,16 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kon-rad/openclaw-trace/internal/ingest"
+	"github.com/kon-rad/openclaw-trace/internal/stream"
 )
 
 type IngestEnqueuer interface {
@@ -13,53 +18,184 @@ type IngestEnqueuer interface {
 }
 
 type IngestHandlers struct {
-	enqueuer IngestEnqueuer
+	enqueuer       IngestEnqueuer
+	maxClockSkew   time.Duration
+	maxEventAge    time.Duration
+	rejectWhenFull bool
+	streams        *stream.Tracker
+	proxy          http.Handler
+	deadLetters    DeadLetterStore
 }
 
+// retryAfterSeconds is sent with 429 responses when the queue is full.
+const retryAfterSeconds = "1"
+
 type traceRequest struct {
-	Provider         string  `json:"provider"`
-	Model            string  `json:"model"`
-	InputText        string  `json:"input_text"`
-	OutputText       string  `json:"output_text"`
-	PromptTokens     int     `json:"prompt_tokens"`
-	CompletionTokens int     `json:"completion_tokens"`
-	TotalTokens      int     `json:"total_tokens"`
-	CostUSD          float64 `json:"cost_usd"`
-	LatencyMS        int     `json:"latency_ms"`
-	Status           string  `json:"status"`
-	ErrorType        string  `json:"error_type"`
-	Metadata         string  `json:"metadata"`
+	TraceID          string          `json:"trace_id"`
+	Provider         string          `json:"provider"`
+	Model            string          `json:"model"`
+	InputText        string          `json:"input_text"`
+	OutputText       string          `json:"output_text"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	TotalTokens      int             `json:"total_tokens"`
+	CostUSD          float64         `json:"cost_usd"`
+	LatencyMS        int             `json:"latency_ms"`
+	Status           string          `json:"status"`
+	ErrorType        string          `json:"error_type"`
+	Metadata         json.RawMessage `json:"metadata"`
+	SessionID        string          `json:"session_id"`
+	RunID            string          `json:"run_id"`
+	SpanID           string          `json:"span_id"`
+	ParentSpanID     string          `json:"parent_span_id"`
+	StartedAt        epochMS         `json:"started_at"`
+	EndedAt          epochMS         `json:"ended_at"`
 }
 
+// errorRequest is keyed by ErrorID; TraceID names the LLM trace the error
+// belongs to, which several errors may share.
 type errorRequest struct {
-	ErrorType  string `json:"error_type"`
-	Message    string `json:"message"`
-	StackTrace string `json:"stack_trace"`
-	Severity   string `json:"severity"`
-	Metadata   string `json:"metadata"`
+	ErrorID    string          `json:"error_id"`
+	TraceID    string          `json:"trace_id"`
+	ErrorType  string          `json:"error_type"`
+	Message    string          `json:"message"`
+	StackTrace string          `json:"stack_trace"`
+	Severity   string          `json:"severity"`
+	Metadata   json.RawMessage `json:"metadata"`
+	OccurredAt epochMS         `json:"occurred_at"`
+}
+
+type eventRequest struct {
+	TraceID    string          `json:"trace_id"`
+	Name       string          `json:"name"`
+	Attributes json.RawMessage `json:"attributes"`
+	Metadata   json.RawMessage `json:"metadata"`
+	OccurredAt epochMS         `json:"occurred_at"`
+}
+
+type toolCallRequest struct {
+	TraceID      string          `json:"trace_id"`
+	LLMTraceID   string          `json:"llm_trace_id"`
+	ToolName     string          `json:"tool_name"`
+	Arguments    json.RawMessage `json:"arguments"`
+	ResultBytes  int64           `json:"result_bytes"`
+	DurationMS   int             `json:"duration_ms"`
+	Status       string          `json:"status"`
+	ErrorType    string          `json:"error_type"`
+	ErrorMessage string          `json:"error_message"`
+	Metadata     json.RawMessage `json:"metadata"`
+	SessionID    string          `json:"session_id"`
+	RunID        string          `json:"run_id"`
+	SpanID       string          `json:"span_id"`
+	ParentSpanID string          `json:"parent_span_id"`
+	StartedAt    epochMS         `json:"started_at"`
+	EndedAt      epochMS         `json:"ended_at"`
+}
+
+const (
+	maxEventNameLength  = 128
+	maxIdentifierLength = 128
+)
+
+// epochMS is a client timestamp in unix milliseconds. It decodes from an
+// RFC3339 string, a JSON number of epoch milliseconds, or a string of digits.
+// Zero means the field was absent.
+type epochMS int64
+
+func (t *epochMS) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" || s == `""` {
+		*t = 0
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		if parsed, err := time.Parse(time.RFC3339Nano, unquoted); err == nil {
+			*t = epochMS(parsed.UnixMilli())
+			return nil
+		}
+		s = unquoted
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms < 0 {
+		return errors.New("timestamp must be RFC3339 or epoch milliseconds")
+	}
+	*t = epochMS(ms)
+	return nil
 }
 
 func NewIngestHandlers(enqueuer IngestEnqueuer) *IngestHandlers {
-	return &IngestHandlers{enqueuer: enqueuer}
+	return &IngestHandlers{
+		enqueuer:     enqueuer,
+		maxClockSkew: ingest.DefaultMaxClockSkew,
+		maxEventAge:  ingest.DefaultMaxEventAge,
+	}
 }
 
-func (h *IngestHandlers) PostTrace(w http.ResponseWriter, r *http.Request) {
-	var req traceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
-		return
+// SetTimeBounds configures how far client timestamps may lead or trail the
+// sidecar clock before they are clamped.
+func (h *IngestHandlers) SetTimeBounds(maxClockSkew time.Duration, maxEventAge time.Duration) {
+	h.maxClockSkew = maxClockSkew
+	h.maxEventAge = maxEventAge
+}
+
+// SetRejectWhenFull makes handlers answer 429 with Retry-After instead of 202
+// when an event cannot be queued.
+func (h *IngestHandlers) SetRejectWhenFull(reject bool) {
+	h.rejectWhenFull = reject
+}
+
+// writeQueueFull reports whether the request was answered because the queue
+// rejected its events.
+func (h *IngestHandlers) writeQueueFull(w http.ResponseWriter, dropped bool) bool {
+	if !dropped || !h.rejectWhenFull {
+		return false
 	}
+	w.Header().Set("Retry-After", retryAfterSeconds)
+	http.Error(w, "ingest queue full", http.StatusTooManyRequests)
+	return true
+}
+
+// enqueue stamps the authenticated source into the event metadata and hands
+// the event to the queue.
+func (h *IngestHandlers) enqueue(r *http.Request, event ingest.Event) bool {
+	stampSource(&event, sourceFromContext(r.Context()))
+	return h.enqueuer.Enqueue(event)
+}
+
+func (h *IngestHandlers) bounds() ingest.TimeBounds {
+	return ingest.NewTimeBounds(time.Now(), h.maxClockSkew, h.maxEventAge)
+}
+
+func (req traceRequest) toEvent(tb ingest.TimeBounds) (ingest.Event, error) {
 	if req.Provider == "" || req.Model == "" {
-		http.Error(w, "provider and model are required", http.StatusBadRequest)
-		return
+		return ingest.Event{}, errors.New("provider and model are required")
+	}
+	if err := validateTraceID(req.TraceID); err != nil {
+		return ingest.Event{}, err
+	}
+	if err := validateHierarchy(req.SessionID, req.RunID, req.SpanID, req.ParentSpanID); err != nil {
+		return ingest.Event{}, err
+	}
+	if err := validateSpan(req.StartedAt, req.EndedAt); err != nil {
+		return ingest.Event{}, err
+	}
+	metadata, err := ingest.NormalizeMetadata(req.Metadata)
+	if err != nil {
+		return ingest.Event{}, err
 	}
 	if req.Status == "" {
 		req.Status = "ok"
 	}
 
-	h.enqueuer.Enqueue(ingest.Event{
+	started, ended, createdAt, metadata := spanTimes(tb, req.StartedAt, req.EndedAt, metadata)
+	if req.LatencyMS == 0 && started > 0 && ended > 0 {
+		req.LatencyMS = int(ended - started)
+	}
+
+	return ingest.Event{
 		Kind:      ingest.EventKindTrace,
-		CreatedAt: time.Now().UnixMilli(),
+		TraceID:   req.TraceID,
+		CreatedAt: createdAt,
 		Trace: &ingest.TracePayload{
 			Provider:         req.Provider,
 			Model:            req.Model,
@@ -72,38 +208,323 @@ func (h *IngestHandlers) PostTrace(w http.ResponseWriter, r *http.Request) {
 			LatencyMS:        req.LatencyMS,
 			Status:           req.Status,
 			ErrorType:        req.ErrorType,
-			Metadata:         req.Metadata,
+			Metadata:         metadata,
+			SessionID:        req.SessionID,
+			RunID:            req.RunID,
+			SpanID:           req.SpanID,
+			ParentSpanID:     req.ParentSpanID,
+			StartedAt:        started,
+			EndedAt:          ended,
 		},
-	})
-
-	w.WriteHeader(http.StatusAccepted)
+	}, nil
 }
 
-func (h *IngestHandlers) PostError(w http.ResponseWriter, r *http.Request) {
-	var req errorRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
-		return
-	}
+func (req errorRequest) toEvent(tb ingest.TimeBounds) (ingest.Event, error) {
 	if req.ErrorType == "" || req.Message == "" {
-		http.Error(w, "error_type and message are required", http.StatusBadRequest)
-		return
+		return ingest.Event{}, errors.New("error_type and message are required")
+	}
+	if len(req.ErrorID) > maxIdentifierLength || len(req.TraceID) > maxIdentifierLength {
+		return ingest.Event{}, errors.New("error_id and trace_id must be at most 128 bytes")
+	}
+	metadata, err := ingest.NormalizeMetadata(req.Metadata)
+	if err != nil {
+		return ingest.Event{}, err
 	}
 	if req.Severity == "" {
 		req.Severity = "error"
 	}
-
-	h.enqueuer.Enqueue(ingest.Event{
+	createdAt, metadata := occurredAt(tb, req.OccurredAt, metadata)
+	return ingest.Event{
 		Kind:      ingest.EventKindError,
-		CreatedAt: time.Now().UnixMilli(),
+		TraceID:   req.ErrorID,
+		CreatedAt: createdAt,
 		Error: &ingest.ErrorPayload{
 			ErrorType:  req.ErrorType,
 			Message:    req.Message,
 			StackTrace: req.StackTrace,
 			Severity:   req.Severity,
-			Metadata:   req.Metadata,
+			Metadata:   metadata,
+			LLMTraceID: req.TraceID,
+		},
+	}, nil
+}
+
+func (req eventRequest) toEvent(tb ingest.TimeBounds) (ingest.Event, error) {
+	if req.Name == "" {
+		return ingest.Event{}, errors.New("name is required")
+	}
+	if len(req.Name) > maxEventNameLength {
+		return ingest.Event{}, errors.New("name is too long")
+	}
+	attributes, ok := compactObject(req.Attributes)
+	if !ok {
+		return ingest.Event{}, errors.New("attributes must be a json object")
+	}
+	if err := validateTraceID(req.TraceID); err != nil {
+		return ingest.Event{}, err
+	}
+	metadata, err := ingest.NormalizeMetadata(req.Metadata)
+	if err != nil {
+		return ingest.Event{}, err
+	}
+	createdAt, metadata := occurredAt(tb, req.OccurredAt, metadata)
+	return ingest.Event{
+		Kind:      ingest.EventKindCustom,
+		TraceID:   req.TraceID,
+		CreatedAt: createdAt,
+		Custom: &ingest.CustomPayload{
+			Name:       req.Name,
+			Attributes: attributes,
+			Metadata:   metadata,
 		},
-	})
+	}, nil
+}
+
+func (req toolCallRequest) toEvent(tb ingest.TimeBounds) (ingest.Event, error) {
+	if req.ToolName == "" {
+		return ingest.Event{}, errors.New("tool_name is required")
+	}
+	if len(req.ToolName) > maxEventNameLength {
+		return ingest.Event{}, errors.New("tool_name is too long")
+	}
+	if req.ResultBytes < 0 || req.DurationMS < 0 {
+		return ingest.Event{}, errors.New("result_bytes and duration_ms must not be negative")
+	}
+	if err := validateTraceID(req.TraceID); err != nil {
+		return ingest.Event{}, err
+	}
+	if len(req.LLMTraceID) > maxIdentifierLength {
+		return ingest.Event{}, errors.New("llm_trace_id must be at most 128 bytes")
+	}
+	if err := validateHierarchy(req.SessionID, req.RunID, req.SpanID, req.ParentSpanID); err != nil {
+		return ingest.Event{}, err
+	}
+	if err := validateSpan(req.StartedAt, req.EndedAt); err != nil {
+		return ingest.Event{}, err
+	}
+	metadata, err := ingest.NormalizeMetadata(req.Metadata)
+	if err != nil {
+		return ingest.Event{}, err
+	}
+	if req.Status == "" {
+		req.Status = "ok"
+		if req.ErrorType != "" || req.ErrorMessage != "" {
+			req.Status = "error"
+		}
+	}
+
+	started, ended, createdAt, metadata := spanTimes(tb, req.StartedAt, req.EndedAt, metadata)
+	if req.DurationMS == 0 && started > 0 && ended > 0 {
+		req.DurationMS = int(ended - started)
+	}
+
+	return ingest.Event{
+		Kind:      ingest.EventKindToolCall,
+		TraceID:   req.TraceID,
+		CreatedAt: createdAt,
+		ToolCall: &ingest.ToolCallPayload{
+			ToolName:     req.ToolName,
+			Arguments:    rawText(req.Arguments),
+			ResultBytes:  req.ResultBytes,
+			DurationMS:   req.DurationMS,
+			Status:       req.Status,
+			ErrorType:    req.ErrorType,
+			ErrorMessage: req.ErrorMessage,
+			LLMTraceID:   req.LLMTraceID,
+			Metadata:     metadata,
+			SessionID:    req.SessionID,
+			RunID:        req.RunID,
+			SpanID:       req.SpanID,
+			ParentSpanID: req.ParentSpanID,
+			StartedAt:    started,
+			EndedAt:      ended,
+		},
+	}, nil
+}
+
+func (h *IngestHandlers) PostTrace(w http.ResponseWriter, r *http.Request) {
+	var req traceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.TraceID == "" {
+		req.TraceID = r.Header.Get("Idempotency-Key")
+	}
+	event, err := req.toEvent(h.bounds())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.writeQueueFull(w, !h.enqueue(r, event)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *IngestHandlers) PostError(w http.ResponseWriter, r *http.Request) {
+	var req errorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.ErrorID == "" {
+		req.ErrorID = r.Header.Get("Idempotency-Key")
+	}
+	event, err := req.toEvent(h.bounds())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.writeQueueFull(w, !h.enqueue(r, event)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *IngestHandlers) PostEvent(w http.ResponseWriter, r *http.Request) {
+	var req eventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.TraceID == "" {
+		req.TraceID = r.Header.Get("Idempotency-Key")
+	}
+	event, err := req.toEvent(h.bounds())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.writeQueueFull(w, !h.enqueue(r, event)) {
+		return
+	}
 
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// spanTimes resolves the boundaries of a timed operation. When the later
+// boundary is outside the time bounds both ends are shifted together so the
+// measured duration survives, and the offset is recorded in metadata. The
+// creation time is the start, else the end, else the sidecar clock.
+func spanTimes(tb ingest.TimeBounds, startedAt, endedAt epochMS, metadata string) (started, ended, createdAt int64, meta string) {
+	started, ended, meta = int64(startedAt), int64(endedAt), metadata
+	latest := max(started, ended)
+	if offset := tb.Offset(latest); latest > 0 && offset != 0 {
+		if started > 0 {
+			started += offset
+		}
+		if ended > 0 {
+			ended += offset
+		}
+		meta = ingest.MergeMetadata(meta, map[string]any{"clock_skew_ms": -offset})
+	}
+	createdAt = tb.Now.UnixMilli()
+	if started > 0 {
+		createdAt = started
+	} else if ended > 0 {
+		createdAt = ended
+	}
+	return started, ended, createdAt, meta
+}
+
+func validateSpan(startedAt, endedAt epochMS) error {
+	if startedAt > 0 && endedAt > 0 && endedAt < startedAt {
+		return errors.New("ended_at must not be before started_at")
+	}
+	return nil
+}
+
+func validateHierarchy(ids ...string) error {
+	for _, id := range ids {
+		if len(id) > maxIdentifierLength {
+			return errors.New("session_id, run_id, span_id and parent_span_id must be at most 128 bytes")
+		}
+	}
+	return nil
+}
+
+func (h *IngestHandlers) PostToolCall(w http.ResponseWriter, r *http.Request) {
+	var req toolCallRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.TraceID == "" {
+		req.TraceID = r.Header.Get("Idempotency-Key")
+	}
+	event, err := req.toEvent(h.bounds())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.writeQueueFull(w, !h.enqueue(r, event)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// occurredAt resolves the creation time of a point-in-time event, falling
+// back to the sidecar clock when the client timestamp is absent or skewed.
+func occurredAt(tb ingest.TimeBounds, ts epochMS, metadata string) (int64, string) {
+	if ts <= 0 {
+		return tb.Now.UnixMilli(), metadata
+	}
+	if offset := tb.Offset(int64(ts)); offset != 0 {
+		return tb.Now.UnixMilli(), ingest.MergeMetadata(metadata, map[string]any{"clock_skew_ms": -offset})
+	}
+	return int64(ts), metadata
+}
+
+// validateTraceID checks a client-supplied row key. An empty value is fine;
+// the worker generates one.
+func validateTraceID(id string) error {
+	if len(id) > maxIdentifierLength {
+		return errors.New("trace_id must be at most 128 bytes")
+	}
+	return nil
+}
+
+// compactObject returns raw re-encoded without insignificant whitespace. An
+// absent or null value yields an empty object; anything other than a JSON
+// object is rejected.
+func compactObject(raw json.RawMessage) (string, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return "{}", true
+	}
+	if trimmed[0] != '{' {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, trimmed); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// rawText returns a JSON string value decoded and any other JSON value in its
+// compact encoding, so tool arguments read naturally whether the client sent
+// a command line or an argument object.
+func rawText(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(trimmed, &s); err == nil {
+		return s
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, trimmed); err != nil {
+		return string(trimmed)
+	}
+	return buf.String()
+}
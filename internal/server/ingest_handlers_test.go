@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -162,3 +163,384 @@ func TestPostTraceQueueSaturationStillReturns202(t *testing.T) {
 		t.Fatalf("second post status = %d, want 202 even when saturated", rec2.Code)
 	}
 }
+
+func TestPostEventAcceptedAndPersisted(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ch := make(chan ingest.Event, ingest.QueueCapacity)
+	worker := ingest.NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ch) }()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	body := []byte(`{"name":"skill_invoked","attributes":{"skill": "web_search", "depth": 2}}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostEvent(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	row, err := dbm.LatestCustomEvent(context.Background())
+	if err != nil {
+		t.Fatalf("query latest custom event: %v", err)
+	}
+	if row.Name != "skill_invoked" {
+		t.Fatalf("name = %q, want skill_invoked", row.Name)
+	}
+	if row.Attributes != `{"skill":"web_search","depth":2}` {
+		t.Fatalf("attributes = %s", row.Attributes)
+	}
+}
+
+func TestPostEventRejectsInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	cases := map[string]string{
+		"missing name":      `{"attributes":{}}`,
+		"array attributes":  `{"name":"x","attributes":[1,2]}`,
+		"string attributes": `{"name":"x","attributes":"k=v"}`,
+	}
+	for name, body := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		h.PostEvent(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestPostTraceUsesIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 2)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+
+	body, _ := json.Marshal(map[string]any{
+		"provider": "anthropic",
+		"model":    "claude-sonnet-4",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	req.Header.Set("Idempotency-Key", "retry-key-1")
+	rec := httptest.NewRecorder()
+	h.PostTrace(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	body, _ = json.Marshal(map[string]any{
+		"trace_id": "body-key-1",
+		"provider": "anthropic",
+		"model":    "claude-sonnet-4",
+	})
+	req = httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	req.Header.Set("Idempotency-Key", "ignored")
+	rec = httptest.NewRecorder()
+	h.PostTrace(rec, req)
+
+	if got := (<-ch).TraceID; got != "retry-key-1" {
+		t.Fatalf("trace_id = %q, want header value", got)
+	}
+	if got := (<-ch).TraceID; got != "body-key-1" {
+		t.Fatalf("trace_id = %q, want body value to win over header", got)
+	}
+}
+
+func TestPostTraceHonorsClientTimestamps(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 2)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+
+	started := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+	ended := started.Add(1250 * time.Millisecond)
+	body, _ := json.Marshal(map[string]any{
+		"provider":   "anthropic",
+		"model":      "claude-sonnet-4",
+		"started_at": started.Format(time.RFC3339Nano),
+		"ended_at":   ended.UnixMilli(),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostTrace(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	ev := <-ch
+	if ev.CreatedAt != started.UnixMilli() {
+		t.Fatalf("created_at = %d, want started_at %d", ev.CreatedAt, started.UnixMilli())
+	}
+	if ev.Trace.StartedAt != started.UnixMilli() || ev.Trace.EndedAt != ended.UnixMilli() {
+		t.Fatalf("unexpected stored boundaries: %+v", ev.Trace)
+	}
+	if ev.Trace.LatencyMS != 1250 {
+		t.Fatalf("latency = %d, want derived 1250", ev.Trace.LatencyMS)
+	}
+	if ev.Trace.Metadata != "" {
+		t.Fatalf("metadata = %q, want untouched", ev.Trace.Metadata)
+	}
+}
+
+func TestPostTraceClampsSkewedTimestamps(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 1)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	h.SetTimeBounds(time.Minute, time.Hour)
+
+	started := time.Now().Add(2 * time.Hour)
+	body, _ := json.Marshal(map[string]any{
+		"provider":   "anthropic",
+		"model":      "claude-sonnet-4",
+		"started_at": started.UnixMilli(),
+		"ended_at":   started.Add(500 * time.Millisecond).UnixMilli(),
+		"latency_ms": 480,
+	})
+	before := time.Now()
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostTrace(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	ev := <-ch
+	if ev.Trace.EndedAt > time.Now().UnixMilli() || ev.Trace.EndedAt < before.UnixMilli() {
+		t.Fatalf("ended_at = %d, want clamped to sidecar clock", ev.Trace.EndedAt)
+	}
+	if ev.Trace.EndedAt-ev.Trace.StartedAt != 500 {
+		t.Fatalf("clamping changed the call duration: %+v", ev.Trace)
+	}
+	if ev.Trace.LatencyMS != 480 {
+		t.Fatalf("latency = %d, want client value kept", ev.Trace.LatencyMS)
+	}
+
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(ev.Trace.Metadata), &meta); err != nil {
+		t.Fatalf("metadata is not json: %v", err)
+	}
+	skew, ok := meta["clock_skew_ms"].(float64)
+	if !ok || skew < float64(time.Hour.Milliseconds()) {
+		t.Fatalf("clock_skew_ms = %v, want about two hours", meta["clock_skew_ms"])
+	}
+}
+
+func TestPostTraceRejectsInvalidTimestamps(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	cases := map[string]string{
+		"unparseable":      `{"provider":"a","model":"b","started_at":"yesterday"}`,
+		"end_before_start": `{"provider":"a","model":"b","started_at":2000,"ended_at":1000}`,
+	}
+	for name, body := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		h.PostTrace(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestPostTraceQueueSaturationRejectsWhenConfigured(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 1)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	h.SetRejectWhenFull(true)
+
+	body, _ := json.Marshal(map[string]any{
+		"provider": "anthropic",
+		"model":    "claude-sonnet-4",
+	})
+
+	req1 := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	rec1 := httptest.NewRecorder()
+	h.PostTrace(rec1, req1)
+	if rec1.Code != http.StatusAccepted {
+		t.Fatalf("first post status = %d, want 202", rec1.Code)
+	}
+
+	req2 := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	rec2 := httptest.NewRecorder()
+	h.PostTrace(rec2, req2)
+	if rec2.Code != http.StatusTooManyRequests {
+		t.Fatalf("second post status = %d, want 429 when saturated", rec2.Code)
+	}
+	if rec2.Header().Get("Retry-After") == "" {
+		t.Fatalf("missing Retry-After header")
+	}
+}
+
+func TestPostTraceAcceptsObjectMetadata(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 1)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	body := `{"provider":"a","model":"b","metadata":{"user":"u1", "feature":{"name":"chat"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader([]byte(body)))
+	rec := httptest.NewRecorder()
+	h.PostTrace(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	ev := <-ch
+	if ev.Trace.Metadata != `{"user":"u1","feature":{"name":"chat"}}` {
+		t.Fatalf("metadata = %q, want compact object", ev.Trace.Metadata)
+	}
+}
+
+func TestPostErrorKeysRowsByErrorID(t *testing.T) {
+	t.Parallel()
+
+	dbm, err := db.Open(filepath.Join(t.TempDir(), "trace.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ch := make(chan ingest.Event, ingest.QueueCapacity)
+	worker := ingest.NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ch) }()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	const traceID = "11111111-1111-4111-8111-111111111111"
+	send := func(body map[string]any, key string) {
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/v1/errors", bytes.NewReader(raw))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.PostError(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202", rec.Code)
+		}
+	}
+	// Two errors of one trace, the first delivered twice.
+	send(map[string]any{"trace_id": traceID, "error_type": "tool_error", "message": "first"}, "err-1")
+	send(map[string]any{"trace_id": traceID, "error_type": "tool_error", "message": "first"}, "err-1")
+	send(map[string]any{"trace_id": traceID, "error_id": "err-2", "error_type": "llm_error", "message": "second"}, "")
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+	ctx := context.Background()
+	if count, err := dbm.ErrorCount(ctx); err != nil || count != 2 {
+		t.Fatalf("error count = %d, %v; want both errors of the trace stored once", count, err)
+	}
+	row, err := dbm.LatestError(ctx)
+	if err != nil {
+		t.Fatalf("latest error: %v", err)
+	}
+	if row.TraceID != "err-2" || row.LLMTraceID != traceID {
+		t.Fatalf("latest error = %+v, want keyed by error_id and linked to the trace", row)
+	}
+	if worker.Duplicates() != 1 {
+		t.Fatalf("duplicates = %d, want the retried delivery skipped", worker.Duplicates())
+	}
+}
+
+func TestPostErrorRejectsInvalidMetadata(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	deep := strings.Repeat(`{"a":`, ingest.MaxMetadataDepth+1) + "1" + strings.Repeat("}", ingest.MaxMetadataDepth+1)
+	cases := map[string]string{
+		"array":    `{"error_type":"crash","message":"m","metadata":[1]}`,
+		"too deep": `{"error_type":"crash","message":"m","metadata":` + deep + `}`,
+	}
+	for name, body := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/v1/errors", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		h.PostError(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestPostToolCallAcceptedAndPersisted(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ch := make(chan ingest.Event, ingest.QueueCapacity)
+	worker := ingest.NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 16)
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ch) }()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	started := time.Now().Add(-time.Second)
+	body, _ := json.Marshal(map[string]any{
+		"llm_trace_id":  "llm-1",
+		"tool_name":     "shell",
+		"arguments":     "ls -la /var/log/openclaw",
+		"result_bytes":  2048,
+		"error_message": "exit status 2",
+		"session_id":    "chat-1",
+		"started_at":    started.UnixMilli(),
+		"ended_at":      started.Add(75 * time.Millisecond).UnixMilli(),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/tool_calls", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostToolCall(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status code = %d, want 202", rec.Code)
+	}
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	row, err := dbm.LatestToolCall(context.Background())
+	if err != nil {
+		t.Fatalf("query latest tool call: %v", err)
+	}
+	if row.ToolName != "shell" || row.LLMTraceID != "llm-1" || row.SessionID != "chat-1" {
+		t.Fatalf("unexpected tool call identity: %+v", row)
+	}
+	if row.Arguments != "ls -la /var/log/" {
+		t.Fatalf("arguments = %q, want truncated to 16 bytes", row.Arguments)
+	}
+	if row.ResultBytes != 2048 || row.DurationMS != 75 || row.Status != "error" || row.ErrorMessage != "exit status 2" {
+		t.Fatalf("unexpected tool call outcome: %+v", row)
+	}
+}
+
+func TestPostToolCallRequiresName(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	req := httptest.NewRequest(http.MethodPost, "/v1/tool_calls", bytes.NewReader([]byte(`{"arguments":{"q":"x"}}`)))
+	rec := httptest.NewRecorder()
+	h.PostToolCall(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
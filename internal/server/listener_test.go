@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenUnixServesHandlers(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "oct.sock")
+	ln, err := ListenUnix(path, 0o600)
+	if err != nil {
+		t.Fatalf("listen unix: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	srv := New("", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, nil, nil)
+	go func() { _ = srv.Serve(ln) }()
+	defer func() { _ = srv.Close() }()
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	resp, err := client.Get("http://unix/health")
+	if err != nil {
+		t.Fatalf("get health over unix socket: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestListenUnixReplacesStaleSocket(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "oct.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("create socket: %v", err)
+	}
+	// Simulate a crashed process: the file stays but nothing accepts.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ln, err := ListenUnix(path, 0o660)
+	if err != nil {
+		t.Fatalf("listen over stale socket: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	if _, err := ListenUnix(path, 0o660); err == nil {
+		t.Fatalf("expected error for socket in use")
+	}
+}
+
+func TestListenUnixRefusesRegularFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "oct.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := ListenUnix(path, 0o660); err == nil {
+		t.Fatalf("expected error for regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("regular file was removed: %v", err)
+	}
+}
+
+func TestListenUnixLeavesOnlyTheSocket(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "oct.sock")
+	ln, err := ListenUnix(path, 0o600)
+	if err != nil {
+		t.Fatalf("listen unix: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "oct.sock" {
+		t.Fatalf("dir entries = %v, %v; want only the socket", entries, err)
+	}
+	if err := ln.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket still present after close: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/otlp"
+)
+
+const maxOTLPBodyBytes = 5 << 20
+
+// PostOTLPTraces is an OTLP/HTTP trace receiver. Exporters point
+// OTEL_EXPORTER_OTLP_ENDPOINT at the /otlp prefix; both the protobuf and the
+// JSON encodings are accepted, optionally gzip-compressed.
+func (h *IngestHandlers) PostOTLPTraces(w http.ResponseWriter, r *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != "application/x-protobuf" && contentType != "application/json" {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, maxOTLPBodyBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		reader = io.LimitReader(gz, maxOTLPBodyBytes)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return
+	}
+
+	var spans []otlp.Span
+	if contentType == "application/x-protobuf" {
+		spans, err = otlp.DecodeProtobuf(body)
+	} else {
+		spans, err = otlp.DecodeJSON(body)
+	}
+	if err != nil {
+		http.Error(w, "invalid otlp payload", http.StatusBadRequest)
+		return
+	}
+
+	dropped := false
+	for _, event := range otlp.ToEvents(spans, time.Now()) {
+		if !h.enqueue(r, event) {
+			dropped = true
+		}
+	}
+	// Exporters retry the whole request; ids derived from the span, and for
+	// exceptions from the event's index and time, keep the already accepted
+	// events from being stored twice.
+	if h.writeQueueFull(w, dropped) {
+		return
+	}
+
+	// An empty ExportTraceServiceResponse signals full success.
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if contentType == "application/json" {
+		_, _ = w.Write([]byte("{}"))
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+func TestPostOTLPTracesJSON(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 4)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	body := []byte(`{"resourceSpans":[{"scopeSpans":[{"spans":[{
+		"traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174","name":"chat",
+		"attributes":[
+			{"key":"gen_ai.system","value":{"stringValue":"anthropic"}},
+			{"key":"gen_ai.request.model","value":{"stringValue":"claude-sonnet-4"}}
+		]}]}]}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/otlp/v1/traces", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.PostOTLPTraces(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want 200", rec.Code)
+	}
+	if len(ch) != 1 {
+		t.Fatalf("enqueued events = %d, want 1", len(ch))
+	}
+	ev := <-ch
+	if ev.Trace == nil || ev.Trace.Provider != "anthropic" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
+
+func TestPostOTLPTracesRejectsUnknownContentType(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	req := httptest.NewRequest(http.MethodPost, "/otlp/v1/traces", bytes.NewReader([]byte("x")))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	h.PostOTLPTraces(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status code = %d, want 415", rec.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+	"github.com/kon-rad/openclaw-trace/internal/providers"
+)
+
+// providerTraceRequest carries a raw provider exchange. Request and response
+// are the provider bodies as JSON values, or as strings holding them, and
+// everything the trace needs is extracted server-side.
+type providerTraceRequest struct {
+	TraceID      string          `json:"trace_id"`
+	Provider     string          `json:"provider"`
+	Model        string          `json:"model"`
+	Request      json.RawMessage `json:"request"`
+	Response     json.RawMessage `json:"response"`
+	StatusCode   int             `json:"status_code"`
+	CostUSD      float64         `json:"cost_usd"`
+	LatencyMS    int             `json:"latency_ms"`
+	Metadata     json.RawMessage `json:"metadata"`
+	SessionID    string          `json:"session_id"`
+	RunID        string          `json:"run_id"`
+	SpanID       string          `json:"span_id"`
+	ParentSpanID string          `json:"parent_span_id"`
+	StartedAt    epochMS         `json:"started_at"`
+	EndedAt      epochMS         `json:"ended_at"`
+}
+
+func (req providerTraceRequest) toEvent(tb ingest.TimeBounds) (ingest.Event, error) {
+	if req.Provider == "" {
+		return ingest.Event{}, errors.New("provider is required")
+	}
+	extracted, err := providers.Extract(req.Provider, providerBody(req.Request), providerBody(req.Response))
+	if err != nil {
+		return ingest.Event{}, err
+	}
+
+	trace := traceRequest{
+		TraceID:          req.TraceID,
+		Provider:         strings.ToLower(req.Provider),
+		Model:            extracted.Model,
+		InputText:        extracted.InputText,
+		OutputText:       extracted.OutputText,
+		PromptTokens:     extracted.PromptTokens,
+		CompletionTokens: extracted.CompletionTokens,
+		TotalTokens:      extracted.TotalTokens,
+		CostUSD:          req.CostUSD,
+		LatencyMS:        req.LatencyMS,
+		ErrorType:        extracted.ErrorType,
+		Metadata:         req.Metadata,
+		SessionID:        req.SessionID,
+		RunID:            req.RunID,
+		SpanID:           req.SpanID,
+		ParentSpanID:     req.ParentSpanID,
+		StartedAt:        req.StartedAt,
+		EndedAt:          req.EndedAt,
+	}
+	if trace.Model == "" {
+		trace.Model = req.Model
+	}
+	if req.StatusCode >= http.StatusBadRequest && trace.ErrorType == "" {
+		trace.ErrorType = fmt.Sprintf("http_%d", req.StatusCode)
+	}
+	if trace.ErrorType != "" {
+		trace.Status = "error"
+	}
+
+	event, err := trace.toEvent(tb)
+	if err != nil {
+		return ingest.Event{}, err
+	}
+	details := extracted.Details()
+	if req.StatusCode > 0 {
+		details["status_code"] = req.StatusCode
+	}
+	event.MergeMetadata(details)
+	return event, nil
+}
+
+// PostProviderTrace records an LLM call from the raw provider request and
+// response bodies.
+func (h *IngestHandlers) PostProviderTrace(w http.ResponseWriter, r *http.Request) {
+	var req providerTraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.TraceID == "" {
+		req.TraceID = r.Header.Get("Idempotency-Key")
+	}
+	event, err := req.toEvent(h.bounds())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.writeQueueFull(w, !h.enqueue(r, event)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// providerBody unwraps a body sent as a JSON string so clients can forward
+// the bytes they received without re-parsing them.
+func providerBody(raw json.RawMessage) []byte {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(trimmed, &s); err == nil {
+		return []byte(s)
+	}
+	return trimmed
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+func TestPostProviderTraceExtractsAnthropicResponse(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 1)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	response := `{"type":"message","model":"claude-sonnet-4-5","stop_reason":"end_turn",` +
+		`"content":[{"type":"text","text":"Hi there"}],` +
+		`"usage":{"input_tokens":5,"output_tokens":7,"cache_read_input_tokens":20}}`
+	body, _ := json.Marshal(map[string]any{
+		"provider":    "Anthropic",
+		"request":     json.RawMessage(`{"model":"claude-sonnet-4-5","messages":[{"role":"user","content":"Hello"}]}`),
+		"response":    response,
+		"status_code": 200,
+		"latency_ms":  420,
+		"session_id":  "chat-1",
+		"metadata":    map[string]any{"agent": "planner"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/provider_traces", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostProviderTrace(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+
+	event := <-ch
+	trace := event.Trace
+	if trace == nil {
+		t.Fatalf("expected trace payload, got %+v", event)
+	}
+	if trace.Provider != "anthropic" || trace.Model != "claude-sonnet-4-5" || trace.Status != "ok" {
+		t.Fatalf("unexpected trace identity: %+v", trace)
+	}
+	if trace.PromptTokens != 25 || trace.CompletionTokens != 7 || trace.TotalTokens != 32 {
+		t.Fatalf("unexpected usage: %+v", trace)
+	}
+	if trace.OutputText != "Hi there" || !strings.Contains(trace.InputText, "Hello") || trace.LatencyMS != 420 {
+		t.Fatalf("unexpected text: %+v", trace)
+	}
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(trace.Metadata), &meta); err != nil {
+		t.Fatalf("decode metadata %q: %v", trace.Metadata, err)
+	}
+	if meta["agent"] != "planner" || meta["stop_reason"] != "end_turn" || meta["cached_tokens"] != float64(20) {
+		t.Fatalf("metadata = %v", meta)
+	}
+}
+
+func TestPostProviderTraceRecordsProviderError(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 1)
+	h := NewIngestHandlers(chanEnqueuer{ch: ch})
+	body := `{"provider":"openai","model":"gpt-4o","status_code":429,` +
+		`"response":{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/provider_traces", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.PostProviderTrace(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+
+	trace := (<-ch).Trace
+	if trace.Status != "error" || trace.ErrorType != "rate_limit_exceeded" || trace.Model != "gpt-4o" {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	if !strings.Contains(trace.Metadata, `"status_code":429`) || !strings.Contains(trace.Metadata, "Rate limit reached") {
+		t.Fatalf("metadata = %s", trace.Metadata)
+	}
+}
+
+func TestPostProviderTraceRejectsUnknownProvider(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	req := httptest.NewRequest(http.MethodPost, "/v1/provider_traces", strings.NewReader(`{"provider":"cohere","model":"x"}`))
+	rec := httptest.NewRecorder()
+	h.PostProviderTrace(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
@@ -5,12 +5,27 @@ import (
 	"time"
 )
 
-func New(addr string, healthHandler http.HandlerFunc, ingestHandlers *IngestHandlers) *http.Server {
+// New builds the HTTP server. A nil access control leaves every endpoint
+// open.
+func New(addr string, healthHandler http.HandlerFunc, ingestHandlers *IngestHandlers, access *AccessControl) *http.Server {
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /health", healthHandler)
+	mux.HandleFunc("GET /health", access.wrapHealth(healthHandler))
 	if ingestHandlers != nil {
-		mux.HandleFunc("POST /v1/traces", ingestHandlers.PostTrace)
-		mux.HandleFunc("POST /v1/errors", ingestHandlers.PostError)
+		mux.HandleFunc("POST /v1/traces", access.Wrap(ingestHandlers.PostTrace))
+		mux.HandleFunc("POST /v1/errors", access.Wrap(ingestHandlers.PostError))
+		mux.HandleFunc("POST /v1/events", access.Wrap(ingestHandlers.PostEvent))
+		mux.HandleFunc("POST /v1/tool_calls", access.Wrap(ingestHandlers.PostToolCall))
+		mux.HandleFunc("POST /v1/provider_traces", access.Wrap(ingestHandlers.PostProviderTrace))
+		mux.HandleFunc("POST /v1/batch", access.Wrap(ingestHandlers.PostBatch))
+		mux.HandleFunc("POST /v1/streams", access.Wrap(ingestHandlers.PostStreamStart))
+		mux.HandleFunc("POST /v1/streams/{id}/first_token", access.Wrap(ingestHandlers.PostStreamFirstToken))
+		mux.HandleFunc("POST /v1/streams/{id}/finish", access.Wrap(ingestHandlers.PostStreamFinish))
+		mux.HandleFunc("POST /otlp/v1/traces", access.Wrap(ingestHandlers.PostOTLPTraces))
+		mux.HandleFunc("GET /v1/dead_letters", access.Wrap(ingestHandlers.GetDeadLetters))
+		mux.HandleFunc("DELETE /v1/dead_letters", access.Wrap(ingestHandlers.DeleteDeadLetters))
+		if ingestHandlers.proxy != nil {
+			mux.HandleFunc("/proxy/", access.wrapProxy(ingestHandlers.proxy.ServeHTTP))
+		}
 	}
 
 	return &http.Server{
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+	"github.com/kon-rad/openclaw-trace/internal/stream"
+)
+
+type streamStartRequest struct {
+	TraceID      string          `json:"trace_id"`
+	Provider     string          `json:"provider"`
+	Model        string          `json:"model"`
+	InputText    string          `json:"input_text"`
+	Metadata     json.RawMessage `json:"metadata"`
+	SessionID    string          `json:"session_id"`
+	RunID        string          `json:"run_id"`
+	SpanID       string          `json:"span_id"`
+	ParentSpanID string          `json:"parent_span_id"`
+}
+
+type streamFinishRequest struct {
+	OutputText       string          `json:"output_text"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	TotalTokens      int             `json:"total_tokens"`
+	CostUSD          float64         `json:"cost_usd"`
+	Status           string          `json:"status"`
+	ErrorType        string          `json:"error_type"`
+	Metadata         json.RawMessage `json:"metadata"`
+}
+
+type streamStartResponse struct {
+	TraceID string `json:"trace_id"`
+}
+
+// SetStreamTracker enables the streaming lifecycle endpoints.
+func (h *IngestHandlers) SetStreamTracker(tracker *stream.Tracker) {
+	h.streams = tracker
+}
+
+// SetProxy mounts a capturing reverse proxy for LLM provider APIs under
+// /proxy/.
+func (h *IngestHandlers) SetProxy(proxy http.Handler) {
+	h.proxy = proxy
+}
+
+// PostStreamStart opens a streaming call. All stream timings are taken from
+// the sidecar clock when each request arrives, so clients must report the
+// lifecycle as it happens.
+func (h *IngestHandlers) PostStreamStart(w http.ResponseWriter, r *http.Request) {
+	if h.streams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req streamStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.TraceID == "" {
+		req.TraceID = r.Header.Get("Idempotency-Key")
+	}
+	if req.Provider == "" || req.Model == "" {
+		http.Error(w, "provider and model are required", http.StatusBadRequest)
+		return
+	}
+	if err := validateTraceID(req.TraceID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateHierarchy(req.SessionID, req.RunID, req.SpanID, req.ParentSpanID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metadata, err := ingest.NormalizeMetadata(req.Metadata)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Abandoned streams are enqueued by the tracker, so the source is
+	// recorded at start as well as at finish.
+	if source := sourceFromContext(r.Context()); source != "" {
+		metadata = ingest.MergeMetadata(metadata, map[string]any{sourceMetadataKey: source})
+	}
+
+	traceID, err := h.streams.Start(stream.Start{
+		TraceID:      req.TraceID,
+		Provider:     req.Provider,
+		Model:        req.Model,
+		InputText:    req.InputText,
+		Metadata:     metadata,
+		SessionID:    req.SessionID,
+		RunID:        req.RunID,
+		SpanID:       req.SpanID,
+		ParentSpanID: req.ParentSpanID,
+	}, time.Now())
+	switch {
+	case errors.Is(err, stream.ErrStreamExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, stream.ErrTooManyOpen):
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(streamStartResponse{TraceID: traceID})
+}
+
+func (h *IngestHandlers) PostStreamFirstToken(w http.ResponseWriter, r *http.Request) {
+	if h.streams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.streams.FirstToken(r.PathValue("id"), time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *IngestHandlers) PostStreamFinish(w http.ResponseWriter, r *http.Request) {
+	if h.streams == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req streamFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	metadata, err := ingest.NormalizeMetadata(req.Metadata)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	event, err := h.streams.Build(id, stream.Finish{
+		OutputText:       req.OutputText,
+		PromptTokens:     req.PromptTokens,
+		CompletionTokens: req.CompletionTokens,
+		TotalTokens:      req.TotalTokens,
+		CostUSD:          req.CostUSD,
+		Status:           req.Status,
+		ErrorType:        req.ErrorType,
+		Metadata:         metadata,
+	}, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// The stream stays open until its trace is queued, so a client told to
+	// retry after a full queue can finish it again.
+	if h.writeQueueFull(w, !h.enqueue(r, event)) {
+		return
+	}
+	h.streams.Remove(id)
+
+	w.WriteHeader(http.StatusAccepted)
+}
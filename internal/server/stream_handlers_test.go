@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/db"
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+	"github.com/kon-rad/openclaw-trace/internal/stream"
+)
+
+func TestStreamLifecyclePersistsTimings(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	dbm, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer func() { _ = dbm.Close() }()
+
+	ch := make(chan ingest.Event, ingest.QueueCapacity)
+	worker := ingest.NewWorker(slog.New(slog.NewJSONHandler(io.Discard, nil)), dbm, 1024)
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ch) }()
+
+	enq := chanEnqueuer{ch: ch}
+	h := NewIngestHandlers(enq)
+	h.SetStreamTracker(stream.NewTracker(enq, time.Minute, 1024))
+	srv := New(":0", func(http.ResponseWriter, *http.Request) {}, h, nil)
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/v1/streams", `{"provider":"anthropic","model":"claude-sonnet-4","input_text":"hi"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("start status = %d, want 201", rec.Code)
+	}
+	var started streamStartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&started); err != nil || started.TraceID == "" {
+		t.Fatalf("start response: %+v, %v", started, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if rec := post("/v1/streams/"+started.TraceID+"/first_token", ``); rec.Code != http.StatusNoContent {
+		t.Fatalf("first_token status = %d, want 204", rec.Code)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if rec := post("/v1/streams/"+started.TraceID+"/finish", `{"output_text":"hello","completion_tokens":8}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("finish status = %d, want 202", rec.Code)
+	}
+	if rec := post("/v1/streams/"+started.TraceID+"/finish", `{}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("repeated finish status = %d, want 404", rec.Code)
+	}
+
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	row, err := dbm.LatestTrace(context.Background())
+	if err != nil {
+		t.Fatalf("query latest trace: %v", err)
+	}
+	if row.TraceID != started.TraceID || row.OutputText != "hello" {
+		t.Fatalf("unexpected trace: %+v", row)
+	}
+	if row.TTFTMS < 20 || row.LatencyMS < row.TTFTMS+20 || row.TokensPerSec <= 0 {
+		t.Fatalf("unexpected timings: ttft=%d latency=%d tps=%v", row.TTFTMS, row.LatencyMS, row.TokensPerSec)
+	}
+}
+
+func TestStreamEndpointsDisabledWithoutTracker(t *testing.T) {
+	t.Parallel()
+
+	h := NewIngestHandlers(chanEnqueuer{ch: make(chan ingest.Event, 1)})
+	req := httptest.NewRequest(http.MethodPost, "/v1/streams", bytes.NewReader([]byte(`{"provider":"a","model":"b"}`)))
+	rec := httptest.NewRecorder()
+	h.PostStreamStart(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestStreamFinishSurvivesFullQueue(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 1)
+	enq := chanEnqueuer{ch: ch}
+	h := NewIngestHandlers(enq)
+	h.SetRejectWhenFull(true)
+	h.SetStreamTracker(stream.NewTracker(enq, time.Minute, 1024))
+	srv := New(":0", func(http.ResponseWriter, *http.Request) {}, h, nil)
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/v1/streams", `{"trace_id":"11111111-1111-4111-8111-111111111111","provider":"openai","model":"gpt-4o"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("start status = %d, want 201", rec.Code)
+	}
+	ch <- ingest.Event{Kind: ingest.EventKindMetric, Metric: &ingest.MetricPayload{}}
+
+	finish := "/v1/streams/11111111-1111-4111-8111-111111111111/finish"
+	if rec := post(finish, `{"output_text":"hello"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("finish on a full queue = %d, want 429", rec.Code)
+	}
+	<-ch
+	if rec := post(finish, `{"output_text":"hello"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("retried finish = %d, want 202", rec.Code)
+	}
+	if ev := <-ch; ev.Trace == nil || ev.Trace.OutputText != "hello" {
+		t.Fatalf("queued event = %+v", ev)
+	}
+	if rec := post(finish, `{}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("finish after success = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+func TestUDPReceiverEnqueuesDatagrams(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	ch := make(chan ingest.Event, 4)
+	receiver := NewUDPReceiver(NewIngestHandlers(chanEnqueuer{ch: ch}), 256)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- receiver.Run(ctx, conn) }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial udp: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	datagrams := []string{
+		`{"type":"trace","provider":"anthropic","model":"claude-sonnet-4","total_tokens":30}`,
+		`{"type":"event","name":"skill_invoked"}`,
+		`not json`,
+		`{"type":"event","name":"` + strings.Repeat("x", 300) + `"}`,
+	}
+	for _, d := range datagrams {
+		if _, err := client.Write([]byte(d)); err != nil {
+			t.Fatalf("write datagram: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for receiver.Stats().Received < int64(len(datagrams)) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("receiver error: %v", err)
+	}
+
+	stats := receiver.Stats()
+	if stats != (UDPStats{Received: 4, Accepted: 2, Malformed: 1, Oversized: 1}) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if first := <-ch; first.Kind != ingest.EventKindTrace || first.Trace.TotalTokens != 30 {
+		t.Fatalf("unexpected first event: %+v", first)
+	}
+	if second := <-ch; second.Kind != ingest.EventKindCustom {
+		t.Fatalf("unexpected second event: %+v", second)
+	}
+}
+
+func TestUDPReceiverAppliesAccessControl(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan ingest.Event, 2)
+	receiver := NewUDPReceiver(NewIngestHandlers(chanEnqueuer{ch: ch}), 0)
+	receiver.SetAccessControl(NewAccessControl(map[string]string{"s3cret": "agent"}, nil))
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4000}
+
+	receiver.handle([]byte(`{"type":"event","name":"a"}`), from)
+	receiver.handle([]byte(`{"type":"event","name":"b","auth_token":"s3cret"}`), from)
+
+	stats := receiver.Stats()
+	if stats.Denied != 1 || stats.Accepted != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if ev := <-ch; ev.Custom.Name != "b" || !strings.Contains(ev.Custom.Metadata, `"auth_source":"agent"`) {
+		t.Fatalf("unexpected event: %+v", ev.Custom)
+	}
+}
@@ -0,0 +1,328 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+const (
+	DefaultAbandonTimeout = 5 * time.Minute
+	// MaxOpen bounds the memory held by streams that were started but not
+	// finished yet.
+	MaxOpen = 4096
+)
+
+var (
+	ErrUnknownStream = errors.New("unknown stream")
+	ErrStreamExists  = errors.New("stream already started")
+	ErrTooManyOpen   = errors.New("too many open streams")
+)
+
+type Enqueuer interface {
+	Enqueue(event ingest.Event) bool
+}
+
+// Start describes a streaming LLM call when it is opened. TraceID becomes the
+// trace row key; one is generated when it is empty.
+type Start struct {
+	TraceID      string
+	Provider     string
+	Model        string
+	InputText    string
+	Metadata     string
+	SessionID    string
+	RunID        string
+	SpanID       string
+	ParentSpanID string
+}
+
+// Finish carries the usage and outcome reported when a stream completes.
+type Finish struct {
+	OutputText       string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CostUSD          float64
+	Status           string
+	ErrorType        string
+	Metadata         string
+}
+
+type openStream struct {
+	start        Start
+	input        ingest.TextInfo
+	startedAt    time.Time
+	firstTokenAt time.Time
+}
+
+// Tracker times streaming calls on the sidecar clock. Callers report the
+// start, the first token and the finish; the tracker turns them into a trace
+// with time-to-first-token, tokens per second and total duration. Streams that
+// are not finished within the abandon timeout are recorded as abandoned
+// traces together with an error event.
+type Tracker struct {
+	enqueuer     Enqueuer
+	timeout      time.Duration
+	maxTextBytes int
+	truncateMode ingest.TruncateMode
+	redact       func(string) string
+
+	mu   sync.Mutex
+	open map[string]*openStream
+
+	abandoned atomic.Int64
+}
+
+func NewTracker(enqueuer Enqueuer, timeout time.Duration, maxTextBytes int) *Tracker {
+	if timeout <= 0 {
+		timeout = DefaultAbandonTimeout
+	}
+	return &Tracker{
+		enqueuer:     enqueuer,
+		timeout:      timeout,
+		maxTextBytes: maxTextBytes,
+		open:         map[string]*openStream{},
+	}
+}
+
+// SetTruncateMode selects how an over-long input is shortened; the default
+// keeps its head.
+func (t *Tracker) SetTruncateMode(mode ingest.TruncateMode) {
+	t.truncateMode = mode
+}
+
+// SetRedact sets the redaction the input is described after, so the stored
+// hash matches the redacted text rather than the raw one.
+func (t *Tracker) SetRedact(redact func(string) string) {
+	t.redact = redact
+}
+
+// Start opens a stream and returns its trace id.
+func (t *Tracker) Start(s Start, now time.Time) (string, error) {
+	if s.TraceID == "" {
+		s.TraceID = uuid.NewString()
+	}
+	// The worker truncates again on insert; doing it here bounds what open
+	// streams hold in memory. The size and hash of the full input are kept
+	// for the trace row.
+	full := s.InputText
+	if t.redact != nil {
+		full = t.redact(full)
+	}
+	input := ingest.DescribeText(full)
+	s.InputText = ingest.TruncateText(s.InputText, t.maxTextBytes, t.truncateMode)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.open[s.TraceID]; ok {
+		return "", ErrStreamExists
+	}
+	if len(t.open) >= MaxOpen {
+		return "", ErrTooManyOpen
+	}
+	t.open[s.TraceID] = &openStream{start: s, input: input, startedAt: now}
+	return s.TraceID, nil
+}
+
+// FirstToken records when the first token arrived. Repeated reports keep the
+// earliest time.
+func (t *Tracker) FirstToken(traceID string, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.open[traceID]
+	if !ok {
+		return ErrUnknownStream
+	}
+	if st.firstTokenAt.IsZero() {
+		st.firstTokenAt = now
+	}
+	return nil
+}
+
+// Finish closes a stream and returns the trace event to enqueue.
+func (t *Tracker) Finish(traceID string, f Finish, now time.Time) (ingest.Event, error) {
+	ev, err := t.Build(traceID, f, now)
+	if err == nil {
+		t.Remove(traceID)
+	}
+	return ev, err
+}
+
+// Build returns the trace event of a finished stream but leaves the stream
+// open, so a finish whose event could not be queued can be retried. Remove
+// closes it once the event is queued.
+func (t *Tracker) Build(traceID string, f Finish, now time.Time) (ingest.Event, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.open[traceID]
+	if !ok {
+		return ingest.Event{}, ErrUnknownStream
+	}
+
+	if f.Status == "" {
+		f.Status = "ok"
+	}
+	if f.TotalTokens == 0 {
+		f.TotalTokens = f.PromptTokens + f.CompletionTokens
+	}
+	ev := st.event(traceID, now)
+	ev.Trace.OutputText = f.OutputText
+	ev.Trace.PromptTokens = f.PromptTokens
+	ev.Trace.CompletionTokens = f.CompletionTokens
+	ev.Trace.TotalTokens = f.TotalTokens
+	ev.Trace.CostUSD = f.CostUSD
+	ev.Trace.Status = f.Status
+	ev.Trace.ErrorType = f.ErrorType
+	ev.Trace.TokensPerSec = tokensPerSec(f.CompletionTokens, st.startedAt, st.firstTokenAt, now)
+	ev.Trace.Metadata = mergeObject(ev.Trace.Metadata, f.Metadata)
+	return ev, nil
+}
+
+// Remove closes a stream without recording it.
+func (t *Tracker) Remove(traceID string) {
+	t.mu.Lock()
+	delete(t.open, traceID)
+	t.mu.Unlock()
+}
+
+// Sweep removes streams older than the abandon timeout and returns an
+// abandoned trace and an error event for each.
+func (t *Tracker) Sweep(now time.Time) []ingest.Event {
+	return t.abandon(now, func(st *openStream) bool { return now.Sub(st.startedAt) >= t.timeout },
+		fmt.Sprintf("was not finished within %s", t.timeout))
+}
+
+// Flush removes every open stream, as at shutdown, and returns an abandoned
+// trace and an error event for each.
+func (t *Tracker) Flush(now time.Time) []ingest.Event {
+	return t.abandon(now, func(*openStream) bool { return true }, "was still open at shutdown")
+}
+
+func (t *Tracker) abandon(now time.Time, expired func(*openStream) bool, reason string) []ingest.Event {
+	t.mu.Lock()
+	var closed map[string]*openStream
+	for id, st := range t.open {
+		if !expired(st) {
+			continue
+		}
+		if closed == nil {
+			closed = map[string]*openStream{}
+		}
+		closed[id] = st
+		delete(t.open, id)
+	}
+	t.mu.Unlock()
+
+	out := make([]ingest.Event, 0, 2*len(closed))
+	for id, st := range closed {
+		trace := st.event(id, now)
+		trace.Trace.Status = "abandoned"
+		trace.Trace.ErrorType = "stream_abandoned"
+		out = append(out, trace, ingest.Event{
+			Kind:      ingest.EventKindError,
+			CreatedAt: now.UnixMilli(),
+			Error: &ingest.ErrorPayload{
+				ErrorType:  "stream_abandoned",
+				Message:    fmt.Sprintf("stream %s %s", id, reason),
+				Severity:   "error",
+				Metadata:   ingest.MergeMetadata(st.start.Metadata, map[string]any{"stream_trace_id": id}),
+				LLMTraceID: id,
+			},
+		})
+		t.abandoned.Add(1)
+	}
+	return out
+}
+
+// Run sweeps for abandoned streams until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(max(t.timeout/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			for _, ev := range t.Sweep(now) {
+				t.enqueuer.Enqueue(ev)
+			}
+		}
+	}
+}
+
+// Open returns the number of streams started but not yet finished.
+func (t *Tracker) Open() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.open)
+}
+
+// Abandoned returns how many streams were closed by the abandon timeout.
+func (t *Tracker) Abandoned() int64 {
+	return t.abandoned.Load()
+}
+
+// event builds the trace for a stream ending at end, with the timing fields
+// that do not depend on how it ended.
+func (st *openStream) event(traceID string, end time.Time) ingest.Event {
+	trace := &ingest.TracePayload{
+		Provider:     st.start.Provider,
+		Model:        st.start.Model,
+		InputText:    st.start.InputText,
+		LatencyMS:    int(end.Sub(st.startedAt).Milliseconds()),
+		Metadata:     st.start.Metadata,
+		SessionID:    st.start.SessionID,
+		RunID:        st.start.RunID,
+		SpanID:       st.start.SpanID,
+		ParentSpanID: st.start.ParentSpanID,
+		StartedAt:    st.startedAt.UnixMilli(),
+		EndedAt:      end.UnixMilli(),
+		InputInfo:    &st.input,
+	}
+	if !st.firstTokenAt.IsZero() {
+		trace.TTFTMS = int(st.firstTokenAt.Sub(st.startedAt).Milliseconds())
+	}
+	return ingest.Event{
+		Kind:      ingest.EventKindTrace,
+		TraceID:   traceID,
+		CreatedAt: st.startedAt.UnixMilli(),
+		Trace:     trace,
+	}
+}
+
+// tokensPerSec measures generation speed from the first token to the end of
+// the stream, falling back to the whole call when no first token was
+// reported.
+func tokensPerSec(tokens int, started, firstToken, ended time.Time) float64 {
+	from := started
+	if !firstToken.IsZero() {
+		from = firstToken
+	}
+	elapsed := ended.Sub(from).Seconds()
+	if tokens <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(tokens) / elapsed
+}
+
+// mergeObject adds the fields of the finish metadata object to the start
+// metadata. A finish value that is not an object replaces it instead.
+func mergeObject(start, finish string) string {
+	if finish == "" {
+		return start
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(finish), &fields); err != nil || fields == nil {
+		return finish
+	}
+	return ingest.MergeMetadata(start, fields)
+}
@@ -0,0 +1,173 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kon-rad/openclaw-trace/internal/ingest"
+)
+
+type sliceEnqueuer struct {
+	events []ingest.Event
+}
+
+func (e *sliceEnqueuer) Enqueue(event ingest.Event) bool {
+	e.events = append(e.events, event)
+	return true
+}
+
+func TestTrackerComputesStreamingTimings(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTracker(&sliceEnqueuer{}, time.Minute, 1024)
+	start := time.UnixMilli(1_700_000_000_000)
+
+	id, err := tr.Start(Start{Provider: "anthropic", Model: "claude-sonnet-4", Metadata: `{"user":"u1"}`}, start)
+	if err != nil || id == "" {
+		t.Fatalf("start: id=%q err=%v", id, err)
+	}
+	if err := tr.FirstToken(id, start.Add(300*time.Millisecond)); err != nil {
+		t.Fatalf("first token: %v", err)
+	}
+	// A repeated report must not move the first token time.
+	_ = tr.FirstToken(id, start.Add(900*time.Millisecond))
+
+	ev, err := tr.Finish(id, Finish{PromptTokens: 12, CompletionTokens: 170, Metadata: `{"finish_reason":"stop"}`}, start.Add(2300*time.Millisecond))
+	if err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if ev.Kind != ingest.EventKindTrace || ev.TraceID != id || ev.CreatedAt != start.UnixMilli() {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	trace := ev.Trace
+	if trace.TTFTMS != 300 || trace.LatencyMS != 2300 || trace.TotalTokens != 182 || trace.Status != "ok" {
+		t.Fatalf("unexpected timings: %+v", trace)
+	}
+	if math.Abs(trace.TokensPerSec-85) > 0.001 {
+		t.Fatalf("tokens_per_sec = %v, want 85", trace.TokensPerSec)
+	}
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(trace.Metadata), &meta); err != nil || meta["user"] != "u1" || meta["finish_reason"] != "stop" {
+		t.Fatalf("metadata = %s, want start and finish fields merged", trace.Metadata)
+	}
+	if tr.Open() != 0 {
+		t.Fatalf("open = %d, want 0", tr.Open())
+	}
+	if _, err := tr.Finish(id, Finish{}, start); !errors.Is(err, ErrUnknownStream) {
+		t.Fatalf("second finish err = %v, want ErrUnknownStream", err)
+	}
+}
+
+func TestTrackerKeepsSizeAndHashOfTruncatedInput(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTracker(&sliceEnqueuer{}, time.Minute, 8)
+	start := time.UnixMilli(1_700_000_000_000)
+	id, err := tr.Start(Start{Provider: "openai", Model: "gpt-4o", InputText: "0123456789abcdef"}, start)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	ev, err := tr.Finish(id, Finish{}, start.Add(time.Second))
+	if err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if ev.Trace.InputText != "01234567" {
+		t.Fatalf("input = %q, want it truncated while open", ev.Trace.InputText)
+	}
+	if info := ev.Trace.InputInfo; info == nil || *info != ingest.DescribeText("0123456789abcdef") {
+		t.Fatalf("input info = %+v, want the full input described", info)
+	}
+}
+
+func TestTrackerDescribesRedactedInput(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTracker(&sliceEnqueuer{}, time.Minute, 8)
+	tr.SetRedact(func(s string) string { return strings.ReplaceAll(s, "secret", "[x]") })
+	start := time.UnixMilli(1_700_000_000_000)
+	id, err := tr.Start(Start{Provider: "openai", Model: "gpt-4o", InputText: "my secret is long"}, start)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	ev, err := tr.Finish(id, Finish{}, start.Add(time.Second))
+	if err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if info := ev.Trace.InputInfo; info == nil || *info != ingest.DescribeText("my [x] is long") {
+		t.Fatalf("input info = %+v, want the redacted input described", info)
+	}
+}
+
+func TestTrackerRejectsDuplicateStart(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTracker(&sliceEnqueuer{}, time.Minute, 1024)
+	now := time.Now()
+	if _, err := tr.Start(Start{TraceID: "s-1", Provider: "a", Model: "b"}, now); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := tr.Start(Start{TraceID: "s-1", Provider: "a", Model: "b"}, now); !errors.Is(err, ErrStreamExists) {
+		t.Fatalf("duplicate start err = %v, want ErrStreamExists", err)
+	}
+	if err := tr.FirstToken("missing", now); !errors.Is(err, ErrUnknownStream) {
+		t.Fatalf("first token err = %v, want ErrUnknownStream", err)
+	}
+}
+
+func TestTrackerSweepAbandonsExpiredStreams(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTracker(&sliceEnqueuer{}, time.Minute, 1024)
+	start := time.UnixMilli(1_700_000_000_000)
+	if _, err := tr.Start(Start{TraceID: "old", Provider: "a", Model: "b"}, start); err != nil {
+		t.Fatalf("start old: %v", err)
+	}
+	_ = tr.FirstToken("old", start.Add(time.Second))
+	if _, err := tr.Start(Start{TraceID: "fresh", Provider: "a", Model: "b"}, start.Add(50*time.Second)); err != nil {
+		t.Fatalf("start fresh: %v", err)
+	}
+
+	events := tr.Sweep(start.Add(61 * time.Second))
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want abandoned trace and error", len(events))
+	}
+	trace, errEv := events[0], events[1]
+	if trace.TraceID != "old" || trace.Trace.Status != "abandoned" || trace.Trace.TTFTMS != 1000 || trace.Trace.LatencyMS != 61_000 {
+		t.Fatalf("unexpected abandoned trace: %+v %+v", trace, trace.Trace)
+	}
+	if errEv.Kind != ingest.EventKindError || errEv.Error.ErrorType != "stream_abandoned" {
+		t.Fatalf("unexpected error event: %+v", errEv)
+	}
+	if tr.Open() != 1 || tr.Abandoned() != 1 {
+		t.Fatalf("open=%d abandoned=%d, want 1/1", tr.Open(), tr.Abandoned())
+	}
+}
+
+func TestTrackerFlushAbandonsEveryOpenStream(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTracker(&sliceEnqueuer{}, time.Minute, 1024)
+	start := time.UnixMilli(1_700_000_000_000)
+	for _, id := range []string{"a", "b"} {
+		if _, err := tr.Start(Start{TraceID: id, Provider: "a", Model: "b"}, start); err != nil {
+			t.Fatalf("start %s: %v", id, err)
+		}
+	}
+	if _, err := tr.Build("a", Finish{}, start.Add(time.Second)); err != nil || tr.Open() != 2 {
+		t.Fatalf("build: %v, open = %d; want the stream left open", err, tr.Open())
+	}
+
+	events := tr.Flush(start.Add(2 * time.Second))
+	if len(events) != 4 || tr.Open() != 0 || tr.Abandoned() != 2 {
+		t.Fatalf("events = %d, open = %d, abandoned = %d", len(events), tr.Open(), tr.Abandoned())
+	}
+	for _, ev := range events {
+		if ev.Error != nil && !strings.Contains(ev.Error.Message, "shutdown") {
+			t.Fatalf("message = %q", ev.Error.Message)
+		}
+	}
+}